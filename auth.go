@@ -0,0 +1,86 @@
+package httpc
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AuthorizationScheme returns the authentication scheme and credentials
+// of the Authorization request header. The scheme is matched case
+// insensitively and returned in lower case so handlers may dispatch on
+// it directly. The ok result reports whether the header was present.
+func AuthorizationScheme(req *http.Request) (scheme, credentials string, ok bool) {
+	v := strings.TrimSpace(req.Header.Get("Authorization"))
+	if v == "" {
+		return "", "", false
+	}
+	scheme, credentials, _ = strings.Cut(v, " ")
+	return strings.ToLower(scheme), strings.TrimSpace(credentials), true
+}
+
+// BearerToken returns the token of a Bearer Authorization request
+// header. The ok result reports whether a bearer token was present.
+func BearerToken(req *http.Request) (string, bool) {
+	scheme, token, ok := AuthorizationScheme(req)
+	if !ok || scheme != "bearer" || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// Token returns the bearer token of the request. The Authorization
+// header takes precedence and the value of the named cookie is used
+// as a fallback, so that browser clients storing the token in an
+// HttpOnly cookie and API clients may be served alike.
+func Token(req *http.Request, cookieName string) (string, bool) {
+	token, ok := BearerToken(req)
+	if ok {
+		return token, true
+	}
+	c, err := req.Cookie(cookieName)
+	if err != nil || c.Value == "" {
+		return "", false
+	}
+	return c.Value, true
+}
+
+// ClientCertificateHeader is the request header consulted by
+// ClientCertificate when the request was not received over a mutually
+// authenticated TLS connection. The header is expected to contain a PEM
+// encoded certificate, optionally URL escaped, as forwarded by a TLS
+// terminating proxy. It is empty by default and must only be set when
+// the proxy is trusted to strip the header from client requests.
+var ClientCertificateHeader string
+
+// ClientCertificate returns the verified client certificate presented
+// over mutual TLS. If there is no verified certificate and the trusted
+// ClientCertificateHeader is configured, the certificate is parsed from
+// the header instead. The ok result reports whether a certificate was found.
+func ClientCertificate(req *http.Request) (*x509.Certificate, bool) {
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 && len(req.TLS.VerifiedChains[0]) > 0 {
+		return req.TLS.VerifiedChains[0][0], true
+	}
+	if ClientCertificateHeader == "" {
+		return nil, false
+	}
+	v := req.Header.Get(ClientCertificateHeader)
+	if v == "" {
+		return nil, false
+	}
+	v, err := url.PathUnescape(v)
+	if err != nil {
+		return nil, false
+	}
+	block, _ := pem.Decode([]byte(v))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, false
+	}
+	return cert, true
+}
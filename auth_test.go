@@ -0,0 +1,132 @@
+package httpc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestAuthorizationScheme(t *testing.T) {
+	tests := map[string]struct {
+		header      string
+		scheme      string
+		credentials string
+		ok          bool
+	}{
+		"absent":  {"", "", "", false},
+		"bearer":  {"Bearer abc.def", "bearer", "abc.def", true},
+		"basic":   {"basic dXNlcjpwYXNz", "basic", "dXNlcjpwYXNz", true},
+		"custom":  {"HMAC keyId=1, signature=abc", "hmac", "keyId=1, signature=abc", true},
+		"spaces":  {"  Bearer   token  ", "bearer", "token", true},
+		"no cred": {"Negotiate", "negotiate", "", true},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		scheme, credentials, ok := AuthorizationScheme(req)
+		if scheme != tt.scheme || credentials != tt.credentials || ok != tt.ok {
+			t.Errorf("TestAuthorizationScheme %s: (%q, %q, %t), expected (%q, %q, %t)", name, scheme, credentials, ok, tt.scheme, tt.credentials, tt.ok)
+		}
+	}
+}
+
+func TestToken(t *testing.T) {
+	tests := map[string]struct {
+		header string
+		cookie string
+		want   string
+		ok     bool
+	}{
+		"none":        {"", "", "", false},
+		"header only": {"Bearer header-token", "", "header-token", true},
+		"cookie only": {"", "cookie-token", "cookie-token", true},
+		"both":        {"Bearer header-token", "cookie-token", "header-token", true},
+		"basic":       {"Basic dXNlcjpwYXNz", "cookie-token", "cookie-token", true},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		if tt.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "token", Value: tt.cookie})
+		}
+		token, ok := Token(req, "token")
+		if token != tt.want || ok != tt.ok {
+			t.Errorf("TestToken %s: (%q, %t), expected (%q, %t)", name, token, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	cert := testCertificate(t, "client")
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	defer func(v string) { ClientCertificateHeader = v }(ClientCertificateHeader)
+	tests := map[string]struct {
+		header  string
+		tls     *tls.ConnectionState
+		trusted bool
+		ok      bool
+	}{
+		"absent":           {"", nil, true, false},
+		"verified":         {"", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}, false, true},
+		"unverified":       {"", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, false, false},
+		"header":           {string(b), nil, true, true},
+		"header escaped":   {url.PathEscape(string(b)), nil, true, true},
+		"header untrusted": {string(b), nil, false, false},
+		"header invalid":   {"invalid", nil, true, false},
+	}
+	for name, tt := range tests {
+		ClientCertificateHeader = ""
+		if tt.trusted {
+			ClientCertificateHeader = "X-Client-Cert"
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.TLS = tt.tls
+		if tt.header != "" {
+			req.Header.Set("X-Client-Cert", tt.header)
+		}
+		c, ok := ClientCertificate(req)
+		if ok != tt.ok {
+			t.Errorf("TestClientCertificate %s: ok %t, expected %t", name, ok, tt.ok)
+			continue
+		}
+		if ok && c.Subject.CommonName != "client" {
+			t.Errorf("TestClientCertificate %s: subject %q", name, c.Subject.CommonName)
+		}
+	}
+}
+
+func testCertificate(t *testing.T, name string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
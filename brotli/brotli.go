@@ -0,0 +1,20 @@
+// Package brotli registers the br content coding with httpc.
+//
+// Import the package for its side effect to compress responses
+// with brotli:
+//
+//	import _ "github.com/pnelson/httpc/brotli"
+package brotli
+
+import (
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/pnelson/httpc"
+)
+
+func init() {
+	httpc.RegisterEncoder("br", func(w io.Writer) io.WriteCloser {
+		return brotli.NewWriter(w)
+	})
+}
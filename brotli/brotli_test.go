@@ -0,0 +1,34 @@
+package brotli
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/pnelson/httpc"
+)
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat("compress me ", 100)
+	h := httpc.Compress(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, body)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if v := w.Header().Get("Content-Encoding"); v != "br" {
+		t.Fatalf("TestCompress: Content-Encoding %q, expected %q", v, "br")
+	}
+	b, err := io.ReadAll(brotli.NewReader(w.Body))
+	if err != nil {
+		t.Fatalf("TestCompress: %v", err)
+	}
+	if string(b) != body {
+		t.Errorf("TestCompress: body mismatch")
+	}
+}
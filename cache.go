@@ -0,0 +1,172 @@
+package httpc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// MaxCachedResponses is the maximum number of responses cached by each
+// route registered with GetCached. When the limit is reached, expired
+// responses are evicted first, followed by those expiring soonest.
+var MaxCachedResponses = 1000
+
+// cachedHeaders are the handler response headers replayed with cached
+// responses. Other headers, such as Set-Cookie, are specific to the
+// request that generated the response and are discarded.
+var cachedHeaders = []string{
+	"Cache-Control",
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Language",
+	"Content-Type",
+	"Link",
+	"Vary",
+}
+
+// GetCached registers a route that only matches the GET and HEAD HTTP
+// methods and whose successful responses are cached in memory for the
+// duration ttl, such as for generated sitemaps. Cached responses are
+// served with ETag and Last-Modified headers and conditional requests
+// are handled. Responses are cached per request path and query, and
+// concurrent requests for an absent or expired response wait for a
+// single run of the handler. Only the representation headers set by
+// the handler, such as Content-Type, are cached. If contentType is not
+// empty, it overrides the Content-Type set by the handler.
+func (m *Mux) GetCached(p string, h Handler, ttl time.Duration, contentType string, opts ...RouteOption) {
+	c := &contentCache{
+		h:           h,
+		ttl:         ttl,
+		contentType: contentType,
+		entries:     make(map[string]*cachedContent),
+	}
+	m.Get(p, c.serve, opts...)
+}
+
+// contentCache caches the generated content of a handler.
+type contentCache struct {
+	h           Handler
+	ttl         time.Duration
+	contentType string
+	group       singleflight.Group
+	mu          sync.Mutex
+	entries     map[string]*cachedContent
+}
+
+// cachedContent is a cached response.
+type cachedContent struct {
+	code    int
+	header  http.Header
+	body    []byte
+	modtime time.Time
+	expires time.Time
+}
+
+// serve replies to the request with the cached content,
+// generating it if absent or expired.
+func (c *contentCache) serve(w http.ResponseWriter, req *http.Request) error {
+	key := req.URL.Path + "?" + req.URL.Query().Encode()
+	e := c.load(key)
+	if e == nil {
+		v, err, _ := c.group.Do(key, func() (interface{}, error) {
+			return c.generate(key, w, req)
+		})
+		if err != nil {
+			return err
+		}
+		e = v.(*cachedContent)
+	}
+	h := w.Header()
+	for k, v := range e.header {
+		h[k] = append([]string(nil), v...)
+	}
+	if e.code != http.StatusOK {
+		w.WriteHeader(e.code)
+		_, err := w.Write(e.body)
+		return writeError(err)
+	}
+	http.ServeContent(w, req, "", e.modtime, bytes.NewReader(e.body))
+	return nil
+}
+
+// load returns the unexpired cached content of key, if any.
+func (c *contentCache) load(key string) *cachedContent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || !time.Now().Before(e.expires) {
+		return nil
+	}
+	return e
+}
+
+// generate runs the handler and caches its response if successful.
+// Unsuccessful responses are returned without being cached.
+func (c *contentCache) generate(key string, w http.ResponseWriter, req *http.Request) (*cachedContent, error) {
+	bw := &bufferedWriter{w: w, header: make(http.Header)}
+	err := c.h(bw, req)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	e := &cachedContent{
+		code:    bw.status(),
+		header:  make(http.Header),
+		body:    bw.buf.Bytes(),
+		modtime: now,
+		expires: now.Add(c.ttl),
+	}
+	for _, k := range cachedHeaders {
+		v := bw.header.Values(k)
+		if len(v) > 0 {
+			e.header[k] = v
+		}
+	}
+	if e.code != http.StatusOK {
+		return e, nil
+	}
+	sum := sha256.Sum256(e.body)
+	e.header.Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	if c.contentType != "" {
+		e.header.Set("Content-Type", c.contentType)
+	}
+	c.store(key, e)
+	return e, nil
+}
+
+// store caches the content of key, evicting entries if the cache is full.
+func (c *contentCache) store(key string, e *cachedContent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= MaxCachedResponses {
+		c.evict(e.modtime)
+	}
+	c.entries[key] = e
+}
+
+// evict removes the expired entries, or the entry expiring
+// soonest if none have expired. The mutex must be held.
+func (c *contentCache) evict(now time.Time) {
+	var oldest string
+	var expires time.Time
+	evicted := false
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+			evicted = true
+			continue
+		}
+		if oldest == "" || e.expires.Before(expires) {
+			oldest = k
+			expires = e.expires
+		}
+	}
+	if !evicted && oldest != "" {
+		delete(c.entries, oldest)
+	}
+}
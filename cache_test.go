@@ -0,0 +1,192 @@
+package httpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMuxGetCached(t *testing.T) {
+	calls := 0
+	m := NewMux()
+	m.GetCached("/sitemap.xml", func(w http.ResponseWriter, req *http.Request) error {
+		calls++
+		_, err := w.Write([]byte("<urlset></urlset>"))
+		return err
+	}, time.Hour, "application/xml")
+	w := testServe(m, httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Body.String() != "<urlset></urlset>" {
+		t.Fatalf("TestMuxGetCached: status %d ETag %q body %q", w.Code, etag, w.Body.String())
+	}
+	if v := w.Header().Get("Content-Type"); v != "application/xml" {
+		t.Errorf("TestMuxGetCached: Content-Type %q", v)
+	}
+	if w.Header().Get("Last-Modified") == "" {
+		t.Errorf("TestMuxGetCached: expected Last-Modified")
+	}
+	tests := map[string]struct {
+		ifNoneMatch string
+		code        int
+	}{
+		"match":    {etag, http.StatusNotModified},
+		"mismatch": {`"stale"`, http.StatusOK},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil)
+		req.Header.Set("If-None-Match", tt.ifNoneMatch)
+		w := testServe(m, req)
+		if w.Code != tt.code {
+			t.Errorf("TestMuxGetCached %s: status %d, expected %d", name, w.Code, tt.code)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("TestMuxGetCached: handler ran %d times, expected 1", calls)
+	}
+}
+
+func TestMuxGetCachedExpiry(t *testing.T) {
+	calls := 0
+	m := NewMux()
+	m.GetCached("/robots.txt", func(w http.ResponseWriter, req *http.Request) error {
+		calls++
+		return RenderPlain(w, "User-agent: *", http.StatusOK)
+	}, time.Millisecond, "")
+	testServe(m, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+	time.Sleep(5 * time.Millisecond)
+	w := testServe(m, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+	if calls != 2 {
+		t.Errorf("TestMuxGetCachedExpiry: handler ran %d times, expected 2", calls)
+	}
+	if v := w.Header().Get("Content-Type"); v != "text/plain; charset=utf-8" {
+		t.Errorf("TestMuxGetCachedExpiry: Content-Type %q", v)
+	}
+}
+
+func TestMuxGetCachedQuery(t *testing.T) {
+	calls := 0
+	m := NewMux()
+	m.GetCached("/feed", func(w http.ResponseWriter, req *http.Request) error {
+		calls++
+		return RenderPlain(w, "page "+req.URL.Query().Get("page"), http.StatusOK)
+	}, time.Hour, "", Name("feed"))
+	tests := []struct {
+		url  string
+		body string
+	}{
+		{"/feed?page=1", "page 1\n"},
+		{"/feed?page=2", "page 2\n"},
+		{"/feed?page=1", "page 1\n"},
+	}
+	for _, tt := range tests {
+		w := testServe(m, httptest.NewRequest(http.MethodGet, tt.url, nil))
+		if w.Body.String() != tt.body {
+			t.Errorf("TestMuxGetCachedQuery %s: body %q, expected %q", tt.url, w.Body.String(), tt.body)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("TestMuxGetCachedQuery: handler ran %d times, expected 2", calls)
+	}
+	if u, err := m.URL("feed", nil); err != nil || u != "/feed" {
+		t.Errorf("TestMuxGetCachedQuery: URL %q error %v, expected route option applied", u, err)
+	}
+}
+
+func TestMuxGetCachedHeaders(t *testing.T) {
+	m := NewMux()
+	m.Use(func(h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("X-Request-ID", req.Header.Get("X-Request-ID"))
+			h.ServeHTTP(w, req)
+		}
+		return http.HandlerFunc(fn)
+	})
+	m.GetCached("/profile", func(w http.ResponseWriter, req *http.Request) error {
+		SetCookie(w, &http.Cookie{Name: "session", Value: req.Header.Get("X-Request-ID")})
+		w.Header().Set("Content-Language", "en")
+		return RenderPlain(w, "profile", http.StatusOK)
+	}, time.Hour, "")
+	for _, id := range []string{"a", "b"} {
+		req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+		req.Header.Set("X-Request-ID", id)
+		w := testServe(m, req)
+		if v := w.Header().Get("Set-Cookie"); v != "" {
+			t.Errorf("TestMuxGetCachedHeaders %s: Set-Cookie %q replayed", id, v)
+		}
+		if v := w.Header().Get("X-Request-ID"); v != id {
+			t.Errorf("TestMuxGetCachedHeaders %s: X-Request-ID %q", id, v)
+		}
+		if v := w.Header().Get("Content-Language"); v != "en" {
+			t.Errorf("TestMuxGetCachedHeaders %s: Content-Language %q", id, v)
+		}
+	}
+}
+
+func TestMuxGetCachedConcurrent(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	m := NewMux()
+	m.GetCached("/slow/:id", func(w http.ResponseWriter, req *http.Request) error {
+		atomic.AddInt32(&calls, 1)
+		if Param(req, "id") == "slow" {
+			<-release
+		}
+		return RenderPlain(w, Param(req, "id"), http.StatusOK)
+	}, time.Hour, "")
+	done := make(chan *httptest.ResponseRecorder, 3)
+	for i := 0; i < 2; i++ {
+		go func() {
+			done <- testServe(m, httptest.NewRequest(http.MethodGet, "/slow/slow", nil))
+		}()
+	}
+	fast := make(chan *httptest.ResponseRecorder)
+	go func() {
+		fast <- testServe(m, httptest.NewRequest(http.MethodGet, "/slow/fast", nil))
+	}()
+	select {
+	case w := <-fast:
+		if w.Body.String() != "fast\n" {
+			t.Errorf("TestMuxGetCachedConcurrent: body %q", w.Body.String())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("TestMuxGetCachedConcurrent: request blocked by a slow handler")
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	for i := 0; i < 2; i++ {
+		w := <-done
+		if w.Body.String() != "slow\n" {
+			t.Errorf("TestMuxGetCachedConcurrent: body %q", w.Body.String())
+		}
+	}
+	if calls != 2 {
+		t.Errorf("TestMuxGetCachedConcurrent: handler ran %d times, expected 2", calls)
+	}
+}
+
+func TestMuxGetCachedBounded(t *testing.T) {
+	defer func(n int) { MaxCachedResponses = n }(MaxCachedResponses)
+	MaxCachedResponses = 2
+	c := &contentCache{
+		h: func(w http.ResponseWriter, req *http.Request) error {
+			return RenderPlain(w, req.URL.Path, http.StatusOK)
+		},
+		ttl:     time.Hour,
+		entries: make(map[string]*cachedContent),
+	}
+	for i := 0; i < 5; i++ {
+		err := c.serve(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/"+strconv.Itoa(i), nil))
+		if err != nil {
+			t.Fatalf("TestMuxGetCachedBounded: %v", err)
+		}
+	}
+	if len(c.entries) != 2 {
+		t.Errorf("TestMuxGetCachedBounded: %d entries, expected 2", len(c.entries))
+	}
+	if c.load("/items/4?") == nil {
+		t.Errorf("TestMuxGetCachedBounded: most recent response evicted")
+	}
+}
@@ -0,0 +1,279 @@
+package httpc
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// An EncodeFunc returns a writer compressing to w with a content coding.
+type EncodeFunc func(w io.Writer) io.WriteCloser
+
+// encoders maps content codings to registered compressing writers.
+// Codings backed by third party packages are registered by their own
+// packages, such as httpc/brotli, to keep the dependencies isolated.
+var encoders = struct {
+	sync.RWMutex
+	m          map[string]EncodeFunc
+	preference []string
+}{
+	m: map[string]EncodeFunc{
+		"gzip": func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		},
+	},
+	preference: []string{"zstd", "br", "gzip", "deflate"},
+}
+
+// RegisterEncoder registers the content coding used by Compress and
+// CompressResponse, such as by importing the httpc/brotli or httpc/zstd
+// packages. The server preference breaks ties between equally weighted
+// codings and prefers zstd, br, gzip and deflate, followed by other
+// codings in the order they are registered.
+func RegisterEncoder(coding string, fn EncodeFunc) {
+	coding = strings.ToLower(coding)
+	encoders.Lock()
+	defer encoders.Unlock()
+	encoders.m[coding] = fn
+	for _, v := range encoders.preference {
+		if v == coding {
+			return
+		}
+	}
+	encoders.preference = append(encoders.preference, coding)
+}
+
+// encoder returns the registered EncodeFunc of the content coding.
+func encoder(coding string) (EncodeFunc, bool) {
+	encoders.RLock()
+	defer encoders.RUnlock()
+	fn, ok := encoders.m[coding]
+	return fn, ok
+}
+
+// CompressMinSize is the minimum response body size in bytes to
+// compress. Smaller responses are written uncompressed since the
+// overhead of the content coding outweighs the savings.
+var CompressMinSize = 1024
+
+// Compress is middleware that compresses responses with the best
+// content coding available in the request Accept-Encoding header.
+// Responses that are already encoded or have a Content-Type that is
+// already compressed, such as images, are written as is. The identity
+// coding is always acceptable, so a client accepting none of the
+// available codings receives an uncompressed response.
+func Compress(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		cw, done := CompressResponse(w, req)
+		defer done()
+		h.ServeHTTP(cw, req)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// CompressResponse returns a http.ResponseWriter that compresses the
+// response written to it with the best content coding available in the
+// request Accept-Encoding header, as described by Compress. Bodies
+// smaller than CompressMinSize are written uncompressed. The returned
+// function must be called once the response is written to flush and
+// close the content coding writer.
+func CompressResponse(w http.ResponseWriter, req *http.Request) (http.ResponseWriter, func() error) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	coding := negotiateEncoding(req.Header.Get("Accept-Encoding"))
+	if coding == "" || req.Method == http.MethodHead {
+		return w, func() error { return nil }
+	}
+	cw := &compressWriter{ResponseWriter: w, coding: coding}
+	return cw, cw.Close
+}
+
+// negotiateEncoding returns the preferred available content coding
+// for the Accept-Encoding header value, or the empty string for the
+// identity coding.
+func negotiateEncoding(accept string) string {
+	if accept == "" {
+		return ""
+	}
+	q := make(map[string]float64)
+	for _, v := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(v), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		weight := 1.0
+		params = strings.TrimSpace(params)
+		if strings.HasPrefix(params, "q=") {
+			f, err := strconv.ParseFloat(params[2:], 64)
+			if err != nil || f < 0 || f > 1 {
+				continue
+			}
+			weight = f
+		}
+		q[coding] = weight
+	}
+	var best string
+	var bestq float64
+	encoders.RLock()
+	defer encoders.RUnlock()
+	for _, coding := range encoders.preference {
+		if _, ok := encoders.m[coding]; !ok {
+			continue
+		}
+		weight, ok := q[coding]
+		if !ok {
+			weight, ok = q["*"]
+		}
+		if ok && weight > bestq {
+			best, bestq = coding, weight
+		}
+	}
+	return best
+}
+
+// compressible reports whether responses of the content type benefit
+// from compression. Media that is already compressed is excluded.
+func compressible(contentType string) bool {
+	media, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return true
+	}
+	switch {
+	case media == "image/svg+xml":
+		return true
+	case strings.HasPrefix(media, "image/"),
+		strings.HasPrefix(media, "audio/"),
+		strings.HasPrefix(media, "video/"),
+		strings.HasPrefix(media, "font/woff"):
+		return false
+	}
+	switch media {
+	case "application/gzip", "application/x-gzip", "application/zip",
+		"application/zstd", "application/x-brotli", "application/x-bzip2",
+		"application/x-xz", "application/x-7z-compressed", "application/pdf":
+		return false
+	}
+	return true
+}
+
+// compressWriter is a http.ResponseWriter that compresses
+// the response body with the negotiated content coding.
+// The body is buffered until it is known to be at least
+// CompressMinSize bytes or flushed.
+type compressWriter struct {
+	http.ResponseWriter
+	coding      string
+	enc         io.WriteCloser
+	code        int
+	buf         []byte
+	wroteHeader bool
+	committed   bool
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+func (w *compressWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.code = code
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || !compressible(h.Get("Content-Type")) ||
+		code == http.StatusNoContent || code == http.StatusNotModified || code < http.StatusOK {
+		w.commit(false)
+		return
+	}
+	n, err := strconv.Atoi(h.Get("Content-Length"))
+	if err == nil && n < CompressMinSize {
+		w.commit(false)
+	}
+}
+
+// commit writes the buffered status code and body,
+// compressed with the content coding if encode is true.
+func (w *compressWriter) commit(encode bool) error {
+	w.committed = true
+	if encode {
+		h := w.Header()
+		h.Set("Content-Encoding", w.coding)
+		h.Del("Content-Length")
+		fn, _ := encoder(w.coding)
+		w.enc = fn(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	b := w.buf
+	w.buf = nil
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(b)
+	} else {
+		_, err = w.ResponseWriter.Write(b)
+	}
+	return err
+}
+
+// Write implements the http.ResponseWriter interface.
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.committed {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < CompressMinSize {
+			return len(b), nil
+		}
+		return len(b), w.commit(true)
+	}
+	if w.enc == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.enc.Write(b)
+}
+
+// Flush implements the http.Flusher interface. Flushing commits
+// to compressing the response regardless of its size.
+func (w *compressWriter) Flush() {
+	if w.wroteHeader && !w.committed {
+		w.commit(true)
+	}
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close writes the response if it is still buffered and
+// flushes and closes the content coding writer, if any.
+func (w *compressWriter) Close() error {
+	if w.wroteHeader && !w.committed {
+		err := w.commit(false)
+		if err != nil {
+			return err
+		}
+	}
+	if w.enc == nil {
+		return nil
+	}
+	return w.enc.Close()
+}
+
+// Unwrap returns the underlying http.ResponseWriter
+// for use with http.ResponseController.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
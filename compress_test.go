@@ -0,0 +1,184 @@
+package httpc
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testNopEncoder is an EncodeFunc writing to w as is.
+func testNopEncoder(w io.Writer) io.WriteCloser {
+	return struct {
+		io.Writer
+		io.Closer
+	}{w, io.NopCloser(nil)}
+}
+
+// testRegisterEncoders registers the content codings with testNopEncoder
+// and returns a function restoring the previously registered codings.
+func testRegisterEncoders(codings ...string) func() {
+	encoders.RLock()
+	m := make(map[string]EncodeFunc, len(encoders.m))
+	for k, v := range encoders.m {
+		m[k] = v
+	}
+	preference := encoders.preference
+	encoders.RUnlock()
+	for _, coding := range codings {
+		RegisterEncoder(coding, testNopEncoder)
+	}
+	return func() {
+		encoders.Lock()
+		defer encoders.Unlock()
+		encoders.m = m
+		encoders.preference = preference
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	defer testRegisterEncoders("br", "zstd")()
+	tests := map[string]string{
+		"":                        "",
+		"identity":                "",
+		"deflate":                 "deflate",
+		"deflate, gzip":           "gzip",
+		"gzip":                    "gzip",
+		"gzip, br":                "br",
+		"gzip, br, zstd":          "zstd",
+		"gzip;q=1, br;q=0.5":      "gzip",
+		"br;q=0.2, zstd;q=0.1":    "br",
+		"*":                       "zstd",
+		"*, zstd;q=0":             "br",
+		"gzip;q=0":                "",
+		"gzip;q=invalid, br":      "br",
+		"GZIP":                    "gzip",
+		"identity;q=1, gzip;q=.5": "gzip",
+	}
+	for accept, want := range tests {
+		coding := negotiateEncoding(accept)
+		if coding != want {
+			t.Errorf("TestNegotiateEncoding %q: %q, expected %q", accept, coding, want)
+		}
+	}
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	tests := map[string]string{
+		"x-test":          "x-test",
+		"X-Test":          "x-test",
+		"x-test, deflate": "deflate",
+		"*":               "gzip",
+		"br":              "",
+	}
+	defer testRegisterEncoders("X-Test")()
+	for accept, want := range tests {
+		coding := negotiateEncoding(accept)
+		if coding != want {
+			t.Errorf("TestRegisterEncoder %q: %q, expected %q", accept, coding, want)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	defer testRegisterEncoders("x-test")()
+	body := strings.Repeat("compress me ", 100)
+	decoders := map[string]func(r io.Reader) (io.Reader, error){
+		"gzip":    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"deflate": func(r io.Reader) (io.Reader, error) { return flate.NewReader(r), nil },
+		"x-test":  func(r io.Reader) (io.Reader, error) { return r, nil },
+		"":        func(r io.Reader) (io.Reader, error) { return r, nil },
+	}
+	tests := map[string]struct {
+		accept      string
+		contentType string
+		want        string
+	}{
+		"gzip":       {"gzip", "text/plain", "gzip"},
+		"registered": {"x-test", "text/plain", "x-test"},
+		"br":         {"br, gzip", "text/plain", "gzip"},
+		"deflate":    {"deflate", "text/plain", "deflate"},
+		"none":       {"identity", "text/plain", ""},
+		"compressed": {"gzip", "image/png", ""},
+	}
+	for name, tt := range tests {
+		h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", tt.contentType)
+			io.WriteString(w, body)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", tt.accept)
+		w := testServe(Compress(h), req)
+		if v := w.Header().Get("Content-Encoding"); v != tt.want {
+			t.Errorf("TestCompress %s: Content-Encoding %q, expected %q", name, v, tt.want)
+			continue
+		}
+		if v := w.Header().Get("Vary"); v != "Accept-Encoding" {
+			t.Errorf("TestCompress %s: Vary %q", name, v)
+		}
+		r, err := decoders[tt.want](bytes.NewReader(w.Body.Bytes()))
+		if err != nil {
+			t.Errorf("TestCompress %s: %v", name, err)
+			continue
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Errorf("TestCompress %s: %v", name, err)
+			continue
+		}
+		if string(b) != body {
+			t.Errorf("TestCompress %s: body mismatch", name)
+		}
+	}
+}
+
+func TestCompressRender(t *testing.T) {
+	defer func(v bool) { CompressRender = v }(CompressRender)
+	CompressRender = true
+	tests := map[string]struct {
+		accept string
+		view   Viewable
+		want   string
+	}{
+		"gzip":    {"gzip", strings.Repeat("a", 2048), "gzip"},
+		"deflate": {"deflate", strings.Repeat("a", 2048), "deflate"},
+		"small":   {"gzip", "a", ""},
+		"none":    {"", strings.Repeat("a", 2048), ""},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Accept-Encoding", tt.accept)
+		w := httptest.NewRecorder()
+		err := Render(w, req, tt.view, http.StatusOK)
+		if err != nil {
+			t.Errorf("TestCompressRender %s: %v", name, err)
+			continue
+		}
+		if v := w.Header().Get("Content-Encoding"); v != tt.want {
+			t.Errorf("TestCompressRender %s: Content-Encoding %q, expected %q", name, v, tt.want)
+			continue
+		}
+		var r io.Reader = w.Body
+		switch tt.want {
+		case "gzip":
+			r, err = gzip.NewReader(r)
+		case "deflate":
+			r = flate.NewReader(r)
+		}
+		if err != nil {
+			t.Errorf("TestCompressRender %s: %v", name, err)
+			continue
+		}
+		var view string
+		err = json.NewDecoder(r).Decode(&view)
+		if err != nil || view != tt.view {
+			t.Errorf("TestCompressRender %s: round trip %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package httpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// WithValue returns a shallow copy of req with val associated with key
+// in its context. Keys should be of an unexported type defined by the
+// caller so that they can not collide with keys defined by other
+// packages, as with httpc's own context keys:
+//
+//	type ctxKey int
+//
+//	const keyUser ctxKey = iota
+//
+//	req = httpc.WithValue(req, keyUser, user)
+//	user, ok := httpc.Value(req, keyUser).(*User)
+func WithValue(req *http.Request, key, val interface{}) *http.Request {
+	ctx := context.WithValue(req.Context(), key, val)
+	return req.WithContext(ctx)
+}
+
+// Value returns the value associated with key in the request context,
+// or nil if there is no such value.
+func Value(req *http.Request, key interface{}) interface{} {
+	return req.Context().Value(key)
+}
+
+// maxRequestIDLength is the maximum length of a request ID accepted
+// from the X-Request-ID header.
+const maxRequestIDLength = 128
+
+// RequestIDHandler is middleware that stores a request ID in the request
+// context for RequestID and sets the X-Request-ID response header. The
+// ID provided by the client or an upstream proxy in the X-Request-ID
+// header is used if it is valid, otherwise a random ID is generated.
+func RequestIDHandler(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		h.ServeHTTP(w, WithValue(req, keyRequestID, id))
+	}
+	return http.HandlerFunc(fn)
+}
+
+// RequestID returns the request ID stored by RequestIDHandler. If the
+// middleware did not run, the request ID provided by the client or an
+// upstream proxy in the X-Request-ID header is returned if it is valid,
+// otherwise the empty string is returned.
+func RequestID(req *http.Request) string {
+	id, ok := Value(req, keyRequestID).(string)
+	if !ok {
+		id = req.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			return ""
+		}
+	}
+	return id
+}
+
+// validRequestID reports whether id is a non-empty request ID of
+// printable ASCII characters that is safe to log and echo.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit request ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
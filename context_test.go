@@ -0,0 +1,96 @@
+package httpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testCtxKey int
+
+const testKeyUser testCtxKey = iota
+
+func TestValue(t *testing.T) {
+	setUser := func(h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, req *http.Request) {
+			h.ServeHTTP(w, WithValue(req, testKeyUser, "alice"))
+		}
+		return http.HandlerFunc(fn)
+	}
+	var user interface{}
+	var other interface{}
+	h := setUser(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user = Value(req, testKeyUser)
+		other = Value(req, keyError)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if user != "alice" {
+		t.Errorf("TestValue: user %v, expected %q", user, "alice")
+	}
+	if other != nil {
+		t.Errorf("TestValue: collided with package key, got %v", other)
+	}
+	if v := Value(req, testKeyUser); v != nil {
+		t.Errorf("TestValue: original request modified, got %v", v)
+	}
+}
+
+func TestRequestIDHandler(t *testing.T) {
+	tests := map[string]struct {
+		header   string
+		generate bool
+	}{
+		"provided":  {"abc123", false},
+		"missing":   {"", true},
+		"too long":  {strings.Repeat("a", maxRequestIDLength+1), true},
+		"invalid":   {"abc\x01", true},
+		"spaces":    {"abc 123", true},
+		"max":       {strings.Repeat("a", maxRequestIDLength), false},
+		"printable": {"a-b_c.1:2", false},
+	}
+	for name, tt := range tests {
+		var id string
+		h := RequestIDHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			id = RequestID(req)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.header != "" {
+			req.Header.Set("X-Request-ID", tt.header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if tt.generate {
+			if len(id) != 32 || id == tt.header {
+				t.Errorf("TestRequestIDHandler %s: id %q, expected generated id", name, id)
+			}
+		} else if id != tt.header {
+			t.Errorf("TestRequestIDHandler %s: id %q, expected %q", name, id, tt.header)
+		}
+		if v := w.Header().Get("X-Request-ID"); v != id {
+			t.Errorf("TestRequestIDHandler %s: header %q, expected %q", name, v, id)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if id := RequestID(req); id != "" {
+		t.Errorf("TestRequestID: %q, expected empty", id)
+	}
+	req.Header.Set("X-Request-ID", "abc123")
+	if id := RequestID(req); id != "abc123" {
+		t.Errorf("TestRequestID: %q, expected %q", id, "abc123")
+	}
+	for _, v := range []string{"abc\r\nX-Injected: 1", "abc 123", strings.Repeat("a", maxRequestIDLength+1)} {
+		req.Header.Set("X-Request-ID", v)
+		if id := RequestID(req); id != "" {
+			t.Errorf("TestRequestID: %q, expected invalid id %q ignored", id, v)
+		}
+	}
+	req = WithValue(req, keyRequestID, "def456")
+	if id := RequestID(req); id != "def456" {
+		t.Errorf("TestRequestID: %q, expected %q", id, "def456")
+	}
+}
@@ -0,0 +1,68 @@
+package httpc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedCookie(t *testing.T) {
+	key := []byte("current")
+	old := []byte("previous")
+	tests := map[string]struct {
+		cookie *http.Cookie
+		key    []byte
+		tamper func(string) string
+		keys   [][]byte
+		want   string
+		err    error
+	}{
+		"valid":        {&http.Cookie{Name: "session", Value: "user=1; admin"}, key, nil, [][]byte{key}, "user=1; admin", nil},
+		"empty":        {&http.Cookie{Name: "session", Value: ""}, key, nil, [][]byte{key}, "", nil},
+		"max age":      {&http.Cookie{Name: "session", Value: "abc", MaxAge: 60}, key, nil, [][]byte{key}, "abc", nil},
+		"rotated":      {&http.Cookie{Name: "session", Value: "abc"}, old, nil, [][]byte{key, old}, "abc", nil},
+		"wrong key":    {&http.Cookie{Name: "session", Value: "abc"}, old, nil, [][]byte{key}, "", ErrInvalidCookie},
+		"no keys":      {&http.Cookie{Name: "session", Value: "abc"}, key, nil, nil, "", ErrInvalidCookie},
+		"expired":      {&http.Cookie{Name: "session", Value: "abc", Expires: time.Now().Add(-time.Hour)}, key, nil, [][]byte{key}, "", ErrExpiredCookie},
+		"tampered":     {&http.Cookie{Name: "session", Value: "abc"}, key, func(v string) string { return "eHl6" + v[4:] }, [][]byte{key}, "", ErrInvalidCookie},
+		"tampered mac": {&http.Cookie{Name: "session", Value: "abc"}, key, func(v string) string { return v[:len(v)-2] + "AA" }, [][]byte{key}, "", ErrInvalidCookie},
+		"tampered exp": {&http.Cookie{Name: "session", Value: "abc", MaxAge: 60}, key, func(v string) string { i := strings.Index(v, "."); return v[:i] + ".0" + v[strings.LastIndex(v, "."):] }, [][]byte{key}, "", ErrInvalidCookie},
+		"unsigned":     {&http.Cookie{Name: "session", Value: "abc"}, key, func(string) string { return "abc" }, [][]byte{key}, "", ErrInvalidCookie},
+		"renamed":      {&http.Cookie{Name: "other", Value: "abc"}, key, nil, [][]byte{key}, "", http.ErrNoCookie},
+	}
+	for name, tt := range tests {
+		w := httptest.NewRecorder()
+		SetSignedCookie(w, tt.cookie, tt.key)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, c := range w.Result().Cookies() {
+			if tt.tamper != nil {
+				c.Value = tt.tamper(c.Value)
+			}
+			req.AddCookie(c)
+		}
+		v, err := SignedCookie(req, "session", tt.keys...)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("TestSignedCookie %s: error %v, expected %v", name, err, tt.err)
+			continue
+		}
+		if v != tt.want {
+			t.Errorf("TestSignedCookie %s: %q, expected %q", name, v, tt.want)
+		}
+	}
+}
+
+func TestSignedCookieName(t *testing.T) {
+	key := []byte("key")
+	w := httptest.NewRecorder()
+	SetSignedCookie(w, &http.Cookie{Name: "a", Value: "abc"}, key)
+	c := w.Result().Cookies()[0]
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "b", Value: c.Value})
+	_, err := SignedCookie(req, "b", key)
+	if err != ErrInvalidCookie {
+		t.Errorf("TestSignedCookieName: error %v, expected %v", err, ErrInvalidCookie)
+	}
+}
@@ -0,0 +1,127 @@
+package httpc
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"goji.io/pattern"
+)
+
+// AllowHeaders returns a RouteOption that declares the request headers
+// accepted by the route from cross-origin requests, such as
+// Authorization or Content-Type. See PreflightAllowed.
+func AllowHeaders(headers ...string) RouteOption {
+	return func(r *route) {
+		for _, h := range headers {
+			r.headers = append(r.headers, http.CanonicalHeaderKey(h))
+		}
+	}
+}
+
+// preflightAllowed is the methods and headers allowed for a preflight request.
+type preflightAllowed struct {
+	methods []string
+	headers []string
+}
+
+// PreflightAllowed returns the sorted HTTP methods and canonical request
+// headers allowed by the routes, including those of sub-muxes, matching
+// the path of a CORS preflight request delegated to the handler set with
+// SetPreflightHandler. Headers are declared with AllowHeaders. PreflightAllowed
+// returns nil for other requests.
+func PreflightAllowed(req *http.Request) (methods, headers []string) {
+	p, ok := req.Context().Value(keyPreflight).(*preflightAllowed)
+	if !ok {
+		return nil, nil
+	}
+	return p.methods, p.headers
+}
+
+// preflight returns the methods and headers allowed by the routes of m
+// and its sub-muxes matching the request before it is routed by m.
+func (m *Mux) preflight(req *http.Request) *preflightAllowed {
+	ctx := req.Context()
+	if pattern.Path(ctx) == "" {
+		ctx = pattern.SetPath(ctx, req.URL.EscapedPath())
+	}
+	methods := make(map[string]bool)
+	headers := make(map[string]bool)
+	m.preflightRoutes(req.WithContext(ctx), methods, headers)
+	p := &preflightAllowed{}
+	for method := range methods {
+		p.methods = append(p.methods, method)
+	}
+	for h := range headers {
+		p.headers = append(p.headers, h)
+	}
+	sort.Strings(p.methods)
+	sort.Strings(p.headers)
+	return p
+}
+
+// preflightRoutes adds the methods and headers of the routes
+// of m and its sub-muxes matching the request.
+func (m *Mux) preflightRoutes(req *http.Request, methods, headers map[string]bool) {
+	for _, r := range m.routes {
+		if r.mux != nil {
+			match := r.pattern.Match(req)
+			if match != nil {
+				r.mux.preflightRoutes(match, methods, headers)
+			}
+			continue
+		}
+		match := r.any.Match(req)
+		if match == nil || !matchWhere(match, r.where) {
+			continue
+		}
+		for method := range r.pattern.HTTPMethods() {
+			methods[method] = true
+		}
+		for _, h := range r.headers {
+			headers[h] = true
+		}
+	}
+}
+
+// PreflightHandler returns a http.Handler for SetPreflightHandler that
+// answers CORS preflight requests from the origins permitted by
+// allowOrigin with the methods and headers allowed by the matching
+// routes. Requested headers are reflected only if allowed by a
+// route. Preflight requests from other origins are forbidden and
+// requests for paths without a matching route are not found.
+func PreflightHandler(allowOrigin func(origin string) bool) http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+		origin := req.Header.Get("Origin")
+		if !allowOrigin(origin) {
+			abort(w, req, http.StatusForbidden)
+			return
+		}
+		methods, headers := PreflightAllowed(req)
+		if len(methods) == 0 {
+			abort(w, req, http.StatusNotFound)
+			return
+		}
+		allowed := make(map[string]bool, len(headers))
+		for _, h := range headers {
+			allowed[h] = true
+		}
+		var allow []string
+		for _, v := range req.Header.Values("Access-Control-Request-Headers") {
+			for _, h := range strings.Split(v, ",") {
+				h = http.CanonicalHeaderKey(strings.TrimSpace(h))
+				if allowed[h] {
+					allow = append(allow, h)
+				}
+			}
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		if len(allow) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(allow, ", "))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return http.HandlerFunc(fn)
+}
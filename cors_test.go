@@ -0,0 +1,72 @@
+package httpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPreflightHandler(t *testing.T) {
+	m := NewMux()
+	m.SetPreflightHandler(PreflightHandler(func(origin string) bool {
+		return origin == "https://example.com"
+	}))
+	h := func(w http.ResponseWriter, req *http.Request) error {
+		return nil
+	}
+	m.Get("/items", h, AllowHeaders("authorization"))
+	m.Post("/items", h, AllowHeaders("Content-Type", "Authorization"))
+	m.Get("/items/:id", h, Where("id", "[0-9]+"))
+	sub := m.NewSubMux("/api/*")
+	sub.Delete("/things/:id", h, AllowHeaders("X-Request-Id"))
+	tests := map[string]struct {
+		path    string
+		origin  string
+		method  string
+		headers string
+		code    int
+		methods string
+		allowed string
+	}{
+		"allowed":            {"/items", "https://example.com", "POST", "content-type", http.StatusNoContent, "GET, HEAD, POST", "Content-Type"},
+		"method not allowed": {"/items", "https://example.com", "DELETE", "", http.StatusNoContent, "GET, HEAD, POST", ""},
+		"header not allowed": {"/items", "https://example.com", "GET", "X-Custom, Authorization", http.StatusNoContent, "GET, HEAD, POST", "Authorization"},
+		"where":              {"/items/42", "https://example.com", "GET", "Authorization", http.StatusNoContent, "GET, HEAD", ""},
+		"where mismatch":     {"/items/new", "https://example.com", "GET", "", http.StatusNotFound, "", ""},
+		"sub-mux":            {"/api/things/1", "https://example.com", "DELETE", "x-request-id", http.StatusNoContent, "DELETE", "X-Request-Id"},
+		"not found":          {"/missing", "https://example.com", "GET", "", http.StatusNotFound, "", ""},
+		"origin":             {"/items", "https://evil.example", "GET", "", http.StatusForbidden, "", ""},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodOptions, tt.path, nil)
+		req.Header.Set("Origin", tt.origin)
+		req.Header.Set("Access-Control-Request-Method", tt.method)
+		if tt.headers != "" {
+			req.Header.Set("Access-Control-Request-Headers", tt.headers)
+		}
+		w := testServe(m, req)
+		if w.Code != tt.code {
+			t.Errorf("TestPreflightHandler %s: status %d, expected %d", name, w.Code, tt.code)
+		}
+		if v := w.Header().Get("Access-Control-Allow-Methods"); v != tt.methods {
+			t.Errorf("TestPreflightHandler %s: methods %q, expected %q", name, v, tt.methods)
+		}
+		if v := w.Header().Get("Access-Control-Allow-Headers"); v != tt.allowed {
+			t.Errorf("TestPreflightHandler %s: headers %q, expected %q", name, v, tt.allowed)
+		}
+		origin := ""
+		if tt.code == http.StatusNoContent {
+			origin = tt.origin
+		}
+		if v := w.Header().Get("Access-Control-Allow-Origin"); v != origin {
+			t.Errorf("TestPreflightHandler %s: origin %q, expected %q", name, v, origin)
+		}
+	}
+}
+
+func TestPreflightAllowed(t *testing.T) {
+	methods, headers := PreflightAllowed(httptest.NewRequest(http.MethodGet, "/", nil))
+	if methods != nil || headers != nil {
+		t.Errorf("TestPreflightAllowed: %v %v, expected nil", methods, headers)
+	}
+}
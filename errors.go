@@ -0,0 +1,252 @@
+package httpc
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// ErrTimeout is returned by handlers that exceed their deadline.
+var ErrTimeout = errors.New("httpc: handler timeout")
+
+// ErrTooManyParts is returned by ValidateMultipart when the request
+// body contains more than MaxMultipartParts parts.
+var ErrTooManyParts = errors.New("httpc: too many multipart parts")
+
+// ErrBodyTooLarge is returned when the declared or actual request
+// body size exceeds the accepted maximum.
+var ErrBodyTooLarge = errors.New("httpc: request body too large")
+
+// ErrUploadTooLarge is returned by ValidateMultipart when the combined
+// size of the uploaded files exceeds the MaxTotalUploadSize of the form.
+var ErrUploadTooLarge = errors.New("httpc: total upload size too large")
+
+// ErrTooManyKeys is returned by ValidateJSON when the request
+// body contains more than MaxJSONKeys object keys.
+var ErrTooManyKeys = errors.New("httpc: too many json object keys")
+
+// ErrUnsupportedMediaType is returned by RejectUnsupported for
+// request bodies of a media type without a registered decoder.
+var ErrUnsupportedMediaType = errors.New("httpc: unsupported media type")
+
+// ErrUnknownField is wrapped by the error returned by ValidateJSON for
+// object keys without a matching form field if DisallowUnknownFields
+// is enabled.
+var ErrUnknownField = errors.New("httpc: unknown json field")
+
+// ErrTrailingData is returned by ValidateJSON when the request
+// body has data after the JSON value.
+var ErrTrailingData = errors.New("httpc: unexpected data after json value")
+
+// ErrUnsupportedCharset is returned by Validate when the request
+// body is declared in a charset that can not be decoded.
+var ErrUnsupportedCharset = errors.New("httpc: unsupported charset")
+
+// ErrInvalidSort is returned by ParseSort for sort fields that
+// are not allowed or repeated.
+var ErrInvalidSort = errors.New("httpc: invalid sort field")
+
+// ErrInvalidPatch is returned by ApplyMergePatch when the request
+// body is not a JSON object or can not be applied to the original.
+var ErrInvalidPatch = errors.New("httpc: invalid merge patch")
+
+// ErrInvalidParam is returned for malformed bound parameters,
+// such as by the Param function of the httpc/uuid package.
+var ErrInvalidParam = errors.New("httpc: invalid parameter")
+
+// ErrInvalidSignature is returned by VerifySignedURL when the
+// signature of the request URL is missing or does not match.
+var ErrInvalidSignature = errors.New("httpc: invalid url signature")
+
+// ErrExpiredURL is returned by VerifySignedURL when the
+// signed request URL has expired.
+var ErrExpiredURL = errors.New("httpc: expired signed url")
+
+// ErrInvalidCookie is returned by SignedCookie when the cookie is
+// malformed or its signature does not match any key.
+var ErrInvalidCookie = errors.New("httpc: invalid signed cookie")
+
+// ErrExpiredCookie is returned by SignedCookie when the
+// signed cookie has expired.
+var ErrExpiredCookie = errors.New("httpc: expired signed cookie")
+
+// ErrInvalidChoice is wrapped by the error returned by OneOf and
+// OneOfFold when the value is not one of the allowed values.
+var ErrInvalidChoice = errors.New("httpc: invalid choice")
+
+// ErrInvalidEmail is returned by ValidateEmail for
+// malformed email addresses.
+var ErrInvalidEmail = errors.New("httpc: invalid email address")
+
+// ErrInvalidURL is returned by ValidateURL for malformed
+// URLs or URLs with a scheme that is not allowed.
+var ErrInvalidURL = errors.New("httpc: invalid url")
+
+// ErrClientDisconnected is wrapped by the error returned by the render
+// functions when the response can not be written because the client
+// closed the connection. Handler errors wrapping ErrClientDisconnected
+// are logged at debug level rather than passed to the error handler.
+var ErrClientDisconnected = errors.New("httpc: client disconnected")
+
+// StatusCoder is implemented by errors that carry an HTTP status code.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// StatusError is an error with an HTTP status code. The default error
+// handler replies with the status code and the error message.
+type StatusError struct {
+	Code int
+	Err  error
+}
+
+// NewStatusError returns a new StatusError with the HTTP status code
+// and the underlying error err, which may be nil.
+func NewStatusError(code int, err error) *StatusError {
+	return &StatusError{Code: code, Err: err}
+}
+
+// Error implements the error interface. The message is that of the
+// underlying error or the status text if there is none.
+func (e *StatusError) Error() string {
+	if e.Err == nil {
+		return http.StatusText(e.Code)
+	}
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode implements the StatusCoder interface.
+func (e *StatusError) StatusCode() int {
+	return e.Code
+}
+
+// ValidationError is returned when a form implementing FieldValidator
+// reports field validation errors. It is rendered with the status code
+// http.StatusUnprocessableEntity.
+type ValidationError struct {
+	Fields map[string]error
+}
+
+// Error implements the error interface. The
+// field errors are ordered by field name.
+func (e *ValidationError) Error() string {
+	names := e.names()
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = name + ": " + e.Fields[name].Error()
+	}
+	return "httpc: invalid fields: " + strings.Join(msgs, "; ")
+}
+
+// StatusCode implements the StatusCoder interface.
+func (e *ValidationError) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+// MarshalJSON implements the json.Marshaler interface. The field
+// errors are encoded as an object of field names to error messages
+// ordered by field name.
+func (e *ValidationError) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]string, len(e.Fields))
+	for name, err := range e.Fields {
+		fields[name] = err.Error()
+	}
+	return json.Marshal(map[string]interface{}{"fields": fields})
+}
+
+// names returns the sorted field names.
+func (e *ValidationError) names() []string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// An ErrorCode maps an error to an HTTP status code in ErrorStatus.
+type ErrorCode struct {
+	Err  error
+	Code int
+}
+
+// ErrorStatus maps errors to the HTTP status code used by RenderError
+// and the default error handler. An error matches an entry if errors.Is
+// reports true for its Err. The first matching entry is used, so that
+// errors wrapping several entries, such as with errors.Join, map to the
+// same status code every time. Applications may add their own errors
+// during program initialization. It must not be modified while serving
+// requests.
+var ErrorStatus = []ErrorCode{
+	{sql.ErrNoRows, http.StatusNotFound},
+	{context.DeadlineExceeded, http.StatusGatewayTimeout},
+	{ErrTimeout, http.StatusGatewayTimeout},
+	{ErrTooManyParts, http.StatusBadRequest},
+	{ErrTooManyKeys, http.StatusBadRequest},
+	{ErrUnknownField, http.StatusBadRequest},
+	{ErrTrailingData, http.StatusBadRequest},
+	{ErrInvalidSort, http.StatusBadRequest},
+	{ErrInvalidParam, http.StatusBadRequest},
+	{ErrInvalidPatch, http.StatusBadRequest},
+	{ErrBodyTooLarge, http.StatusRequestEntityTooLarge},
+	{ErrUploadTooLarge, http.StatusRequestEntityTooLarge},
+	{ErrUnsupportedMediaType, http.StatusUnsupportedMediaType},
+	{ErrUnsupportedCharset, http.StatusUnsupportedMediaType},
+	{ErrInvalidSignature, http.StatusForbidden},
+	{ErrExpiredURL, http.StatusGone},
+	{ErrInvalidCookie, http.StatusForbidden},
+	{ErrExpiredCookie, http.StatusForbidden},
+	{ErrInvalidChoice, http.StatusBadRequest},
+	{ErrInvalidEmail, http.StatusBadRequest},
+	{ErrInvalidURL, http.StatusBadRequest},
+}
+
+// statusCode returns the HTTP status code for err. The status code of
+// an error implementing StatusCoder takes precedence over ErrorStatus.
+// Unknown errors are http.StatusInternalServerError.
+func statusCode(err error) int {
+	var sc StatusCoder
+	if errors.As(err, &sc) {
+		return sc.StatusCode()
+	}
+	for _, ec := range ErrorStatus {
+		if errors.Is(err, ec.Err) {
+			return ec.Code
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// RenderError writes the status text of the HTTP status code inferred
+// from err in the requested format. The status code is that of an error
+// implementing StatusCoder, or the matching entry of ErrorStatus, and
+// defaults to http.StatusInternalServerError. The error message itself
+// is not written so that internal details are not exposed to clients.
+func RenderError(w http.ResponseWriter, req *http.Request, err error) error {
+	code := statusCode(err)
+	return Render(w, req, http.StatusText(code), code)
+}
+
+// writeError returns err wrapped with ErrClientDisconnected
+// if it reports that the client closed the connection.
+func writeError(err error) error {
+	if err == nil || errors.Is(err, ErrClientDisconnected) {
+		return err
+	}
+	if errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, net.ErrClosed) {
+		return fmt.Errorf("%w: %w", ErrClientDisconnected, err)
+	}
+	return err
+}
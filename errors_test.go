@@ -0,0 +1,154 @@
+package httpc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+type testStatusError int
+
+func (e testStatusError) Error() string {
+	return "test status error"
+}
+
+func (e testStatusError) StatusCode() int {
+	return int(e)
+}
+
+func TestRenderError(t *testing.T) {
+	errCustom := errors.New("custom")
+	defer func(s []ErrorCode) { ErrorStatus = s }(ErrorStatus)
+	ErrorStatus = append(ErrorStatus[:len(ErrorStatus):len(ErrorStatus)], ErrorCode{errCustom, http.StatusConflict})
+	tests := map[string]struct {
+		err  error
+		code int
+	}{
+		"no rows":      {sql.ErrNoRows, http.StatusNotFound},
+		"wrapped":      {fmt.Errorf("user: %w", sql.ErrNoRows), http.StatusNotFound},
+		"deadline":     {context.DeadlineExceeded, http.StatusGatewayTimeout},
+		"timeout":      {ErrTimeout, http.StatusGatewayTimeout},
+		"status coder": {fmt.Errorf("wrapped: %w", testStatusError(http.StatusPaymentRequired)), http.StatusPaymentRequired},
+		"cookie":       {ErrInvalidCookie, http.StatusForbidden},
+		"expired":      {ErrExpiredCookie, http.StatusForbidden},
+		"choice":       {OneOf("c", "a", "b"), http.StatusBadRequest},
+		"email":        {ErrInvalidEmail, http.StatusBadRequest},
+		"url":          {ErrInvalidURL, http.StatusBadRequest},
+		"custom":       {errCustom, http.StatusConflict},
+		"joined":       {errors.Join(ErrExpiredURL, ErrInvalidSignature), http.StatusForbidden},
+		"unknown":      {errors.New("unknown"), http.StatusInternalServerError},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", "text/plain")
+		w := httptest.NewRecorder()
+		err := RenderError(w, req, tt.err)
+		if err != nil {
+			t.Errorf("TestRenderError %s: %v", name, err)
+			continue
+		}
+		if w.Code != tt.code {
+			t.Errorf("TestRenderError %s: status %d, expected %d", name, w.Code, tt.code)
+		}
+		if strings.TrimSpace(w.Body.String()) != http.StatusText(tt.code) {
+			t.Errorf("TestRenderError %s: body %q", name, w.Body.String())
+		}
+	}
+	w := httptest.NewRecorder()
+	RenderError(w, httptest.NewRequest(http.MethodGet, "/", nil), sql.ErrNoRows)
+	if w.Header().Get("Content-Type") != "application/json; charset=utf-8" || w.Body.String() != `"Not Found"` {
+		t.Errorf("TestRenderError: negotiated %q %q", w.Header().Get("Content-Type"), w.Body.String())
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	errNotFound := errors.New("user not found")
+	tests := map[string]struct {
+		err  error
+		code int
+		body string
+	}{
+		"status error": {NewStatusError(http.StatusNotFound, errNotFound), http.StatusNotFound, "user not found"},
+		"wrapped":      {fmt.Errorf("lookup: %w", NewStatusError(http.StatusConflict, errNotFound)), http.StatusConflict, "user not found"},
+		"nil err":      {NewStatusError(http.StatusForbidden, nil), http.StatusForbidden, "Forbidden"},
+		"plain":        {errNotFound, http.StatusInternalServerError, "Internal Server Error"},
+	}
+	for name, tt := range tests {
+		m := NewMux()
+		m.Get("/", func(w http.ResponseWriter, req *http.Request) error {
+			return tt.err
+		})
+		w := testServe(m, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != tt.code {
+			t.Errorf("TestStatusError %s: status %d, expected %d", name, w.Code, tt.code)
+		}
+		if have := strings.TrimSpace(w.Body.String()); have != tt.body {
+			t.Errorf("TestStatusError %s: body %q, expected %q", name, have, tt.body)
+		}
+	}
+	err := NewStatusError(http.StatusNotFound, errNotFound)
+	if !errors.Is(err, errNotFound) {
+		t.Errorf("TestStatusError: expected errors.Is to unwrap")
+	}
+}
+
+type testDisconnectedWriter struct {
+	*httptest.ResponseRecorder
+	err error
+}
+
+func (w testDisconnectedWriter) Write(b []byte) (int, error) {
+	return 0, w.err
+}
+
+func TestWriteError(t *testing.T) {
+	other := errors.New("write failed")
+	tests := map[string]struct {
+		err          error
+		disconnected bool
+	}{
+		"nil":         {nil, false},
+		"other":       {other, false},
+		"broken pipe": {&net.OpError{Op: "write", Net: "tcp", Err: syscall.EPIPE}, true},
+		"reset":       {&net.OpError{Op: "write", Net: "tcp", Err: syscall.ECONNRESET}, true},
+		"closed":      {fmt.Errorf("write: %w", net.ErrClosed), true},
+		"wrapped":     {fmt.Errorf("%w: %w", ErrClientDisconnected, syscall.EPIPE), true},
+	}
+	for name, tt := range tests {
+		err := writeError(tt.err)
+		if errors.Is(err, ErrClientDisconnected) != tt.disconnected {
+			t.Errorf("TestWriteError %s: %v, expected disconnected %t", name, err, tt.disconnected)
+		}
+		if !errors.Is(err, tt.err) {
+			t.Errorf("TestWriteError %s: %v does not wrap %v", name, err, tt.err)
+		}
+	}
+}
+
+func TestClientDisconnected(t *testing.T) {
+	var rendered error
+	m := NewMux()
+	m.Get("/", func(w http.ResponseWriter, req *http.Request) error {
+		rendered = RenderJSON(w, map[string]string{"name": "foo"}, http.StatusOK)
+		return rendered
+	})
+	m.SetErrorHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t.Errorf("TestClientDisconnected: error handler called with %v", Error(req))
+	}))
+	rec := httptest.NewRecorder()
+	w := testDisconnectedWriter{rec, &net.OpError{Op: "write", Net: "tcp", Err: syscall.EPIPE}}
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !errors.Is(rendered, ErrClientDisconnected) {
+		t.Errorf("TestClientDisconnected: %v, expected %v", rendered, ErrClientDisconnected)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("TestClientDisconnected: body %q, expected empty", rec.Body.String())
+	}
+}
@@ -0,0 +1,67 @@
+package httpc
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+)
+
+// OneOf returns an error wrapping ErrInvalidChoice that names the value
+// and the allowed values if value is not one of allowed.
+func OneOf(value string, allowed ...string) error {
+	for _, v := range allowed {
+		if value == v {
+			return nil
+		}
+	}
+	return invalidChoice(value, allowed)
+}
+
+// OneOfFold is like OneOf but compares values case-insensitively.
+func OneOfFold(value string, allowed ...string) error {
+	for _, v := range allowed {
+		if strings.EqualFold(value, v) {
+			return nil
+		}
+	}
+	return invalidChoice(value, allowed)
+}
+
+// invalidChoice returns the error for a value not in allowed.
+func invalidChoice(value string, allowed []string) error {
+	return fmt.Errorf("%w %q, must be one of %s", ErrInvalidChoice, value, strings.Join(allowed, ", "))
+}
+
+// ValidateEmail trims and validates the email address s and returns
+// it with the domain in lower case. Display names and angle brackets
+// are not permitted.
+func ValidateEmail(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Name != "" || addr.Address != s {
+		return "", ErrInvalidEmail
+	}
+	i := strings.LastIndexByte(s, '@')
+	return s[:i+1] + strings.ToLower(s[i+1:]), nil
+}
+
+// ValidateURL trims and validates the absolute URL s and returns it
+// with the scheme and host in lower case. The scheme must be one of
+// schemes, which defaults to http and https.
+func ValidateURL(s string, schemes ...string) (string, error) {
+	if len(schemes) == 0 {
+		schemes = []string{"http", "https"}
+	}
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil || u.Host == "" {
+		return "", ErrInvalidURL
+	}
+	u.Host = strings.ToLower(u.Host)
+	for _, scheme := range schemes {
+		if u.Scheme == strings.ToLower(scheme) {
+			return u.String(), nil
+		}
+	}
+	return "", ErrInvalidURL
+}
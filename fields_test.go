@@ -0,0 +1,92 @@
+package httpc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOneOf(t *testing.T) {
+	tests := map[string]struct {
+		fn      func(string, ...string) error
+		value   string
+		isValid bool
+	}{
+		"valid":          {OneOf, "asc", true},
+		"invalid":        {OneOf, "up", false},
+		"case sensitive": {OneOf, "ASC", false},
+		"empty":          {OneOf, "", false},
+		"fold valid":     {OneOfFold, "ASC", true},
+		"fold invalid":   {OneOfFold, "up", false},
+	}
+	for name, tt := range tests {
+		err := tt.fn(tt.value, "asc", "desc")
+		switch {
+		case tt.isValid && err != nil:
+			t.Errorf("TestOneOf %s: %v", name, err)
+		case !tt.isValid && !errors.Is(err, ErrInvalidChoice):
+			t.Errorf("TestOneOf %s: %v, expected ErrInvalidChoice", name, err)
+		}
+	}
+	err := OneOf("up", "asc", "desc")
+	want := `httpc: invalid choice "up", must be one of asc, desc`
+	if err == nil || err.Error() != want {
+		t.Errorf("TestOneOf: %v, expected %q", err, want)
+	}
+}
+
+func TestValidateEmail(t *testing.T) {
+	tests := map[string]struct {
+		in      string
+		want    string
+		isValid bool
+	}{
+		"valid":        {"foo@example.com", "foo@example.com", true},
+		"normalized":   {"  Foo@Example.COM ", "Foo@example.com", true},
+		"subdomain":    {"a.b+c@mail.example.org", "a.b+c@mail.example.org", true},
+		"display name": {"Foo <foo@example.com>", "", false},
+		"brackets":     {"<foo@example.com>", "", false},
+		"missing at":   {"foo.example.com", "", false},
+		"missing user": {"@example.com", "", false},
+		"empty":        {"", "", false},
+	}
+	for name, tt := range tests {
+		s, err := ValidateEmail(tt.in)
+		switch {
+		case tt.isValid && err != nil:
+			t.Errorf("TestValidateEmail %s: %v", name, err)
+		case !tt.isValid && err == nil:
+			t.Errorf("TestValidateEmail %s: expected error", name)
+		case s != tt.want:
+			t.Errorf("TestValidateEmail %s: %q, expected %q", name, s, tt.want)
+		}
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	tests := map[string]struct {
+		in      string
+		schemes []string
+		want    string
+		isValid bool
+	}{
+		"valid":          {"https://example.com/a?b=c", nil, "https://example.com/a?b=c", true},
+		"normalized":     {" HTTP://Example.COM/Path ", nil, "http://example.com/Path", true},
+		"relative":       {"/foo/bar", nil, "", false},
+		"no host":        {"http://", nil, "", false},
+		"scheme default": {"ftp://example.com", nil, "", false},
+		"scheme allowed": {"ftp://example.com", []string{"ftp"}, "ftp://example.com", true},
+		"scheme case":    {"wss://example.com", []string{"WSS"}, "wss://example.com", true},
+		"invalid":        {"http://exa mple.com", nil, "", false},
+	}
+	for name, tt := range tests {
+		s, err := ValidateURL(tt.in, tt.schemes...)
+		switch {
+		case tt.isValid && err != nil:
+			t.Errorf("TestValidateURL %s: %v", name, err)
+		case !tt.isValid && err == nil:
+			t.Errorf("TestValidateURL %s: expected error", name)
+		case s != tt.want:
+			t.Errorf("TestValidateURL %s: %q, expected %q", name, s, tt.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package httpc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HashFileServer registers a file system with the mux that sets a strong
+// ETag computed from the content hash of each file and replies to requests
+// with a matching If-None-Match header with http.StatusNotModified. Unlike
+// FileServer, identical content revalidates regardless of its modification
+// time. Hashes are cached until the size or modification time of the file
+// changes. The pattern p is expected to be a prefix wildcard route.
+func (m *Mux) HashFileServer(p string, fs http.FileSystem) {
+	prefix := p[:len(p)-1]
+	h := &hashFileServer{
+		fs:    fs,
+		next:  http.FileServer(fs),
+		cache: make(map[string]hashEntry),
+	}
+	m.Handle(p, http.StripPrefix(prefix, h))
+}
+
+// hashFileServer is a file server that sets content hash ETags.
+type hashFileServer struct {
+	fs    http.FileSystem
+	next  http.Handler
+	mu    sync.RWMutex
+	cache map[string]hashEntry
+}
+
+// hashEntry is a cached content hash.
+type hashEntry struct {
+	size    int64
+	modtime time.Time
+	etag    string
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (h *hashFileServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	name := req.URL.Path
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	name = path.Clean(name)
+	f, err := h.fs.Open(name)
+	if err != nil {
+		h.next.ServeHTTP(w, req)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		h.next.ServeHTTP(w, req)
+		return
+	}
+	etag, err := h.etag(name, fi.Size(), fi.ModTime(), f)
+	if err != nil {
+		Abort(w, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, req, fi.Name(), fi.ModTime(), f)
+}
+
+// etag returns the cached content hash ETag of the named file,
+// computing it from f if absent or stale.
+func (h *hashFileServer) etag(name string, size int64, modtime time.Time, f http.File) (string, error) {
+	h.mu.RLock()
+	e, ok := h.cache[name]
+	h.mu.RUnlock()
+	if ok && e.size == size && e.modtime.Equal(modtime) {
+		return e.etag, nil
+	}
+	hash := sha256.New()
+	_, err := io.Copy(hash, f)
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)) + `"`
+	h.mu.Lock()
+	h.cache[name] = hashEntry{size: size, modtime: modtime, etag: etag}
+	h.mu.Unlock()
+	return etag, nil
+}
@@ -0,0 +1,41 @@
+package httpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestHashFileServer(t *testing.T) {
+	fs := fstest.MapFS{
+		"app.js":     {Data: []byte("console.log(1)"), ModTime: time.Now()},
+		"app.old.js": {Data: []byte("console.log(1)"), ModTime: time.Now().Add(-time.Hour)},
+	}
+	m := NewMux()
+	m.HashFileServer("/static/*", http.FS(fs))
+	w := testServe(m, httptest.NewRequest(http.MethodGet, "/static/app.js", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Body.String() != "console.log(1)" {
+		t.Fatalf("TestHashFileServer: status %d ETag %q body %q", w.Code, etag, w.Body.String())
+	}
+	tests := map[string]struct {
+		path        string
+		ifNoneMatch string
+		code        int
+	}{
+		"match":         {"/static/app.js", etag, http.StatusNotModified},
+		"match renamed": {"/static/app.old.js", etag, http.StatusNotModified},
+		"mismatch":      {"/static/app.js", `"stale"`, http.StatusOK},
+		"not found":     {"/static/missing.js", etag, http.StatusNotFound},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("If-None-Match", tt.ifNoneMatch)
+		w := testServe(m, req)
+		if w.Code != tt.code {
+			t.Errorf("TestHashFileServer %s: status %d, expected %d", name, w.Code, tt.code)
+		}
+	}
+}
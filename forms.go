@@ -1,11 +1,23 @@
 package httpc
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
 	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"sync"
 
 	"github.com/gorilla/schema"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
 )
 
 // A Form represents a form with validation.
@@ -14,27 +26,137 @@ type Form interface {
 	Validate() error
 }
 
+// FieldValidator represents a form that reports all of its field
+// validation errors at once rather than only the first.
+type FieldValidator interface {
+	// ValidateFields returns a map of field names to validation
+	// errors, or an empty map if all fields are valid.
+	ValidateFields() map[string]error
+}
+
+// validate validates the form. If the form implements FieldValidator
+// and reports field errors, a *ValidationError is returned before
+// Validate is called.
+func validate(form Form) error {
+	fv, ok := form.(FieldValidator)
+	if ok {
+		fields := fv.ValidateFields()
+		if len(fields) > 0 {
+			return &ValidationError{Fields: fields}
+		}
+	}
+	return form.Validate()
+}
+
+// ValidateValue validates a form decoded by other means, such as by a
+// DecodeFunc registered with RegisterDecoder, the same as Validate.
+func ValidateValue(form Form) error {
+	return validate(form)
+}
+
 // UploadForm represents a form with a maximum file upload size.
 type UploadForm interface {
 	// MaxUploadSize returns the maximum file upload size in bytes.
 	MaxUploadSize() int64
 }
 
+// TotalUploadForm represents a form with a maximum combined
+// size of all uploaded files.
+type TotalUploadForm interface {
+	// MaxTotalUploadSize returns the maximum combined
+	// size of all uploaded files in bytes.
+	MaxTotalUploadSize() int64
+}
+
+// BodySizeForm represents a form with a maximum request body size.
+type BodySizeForm interface {
+	// MaxBodySize returns the maximum request body size in bytes.
+	MaxBodySize() int64
+}
+
+// maxBodySize returns the maximum request body size for form.
+func maxBodySize(form Form) int64 {
+	bf, ok := form.(BodySizeForm)
+	if ok {
+		return bf.MaxBodySize()
+	}
+	return DefaultMaxBodySize
+}
+
+// bodyError returns ErrBodyTooLarge if err is the result of
+// reading beyond the limit of a http.MaxBytesReader.
+func bodyError(err error) error {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return ErrBodyTooLarge
+	}
+	return err
+}
+
+// A DecodeFunc decodes, sanitizes and validates the request body
+// and stores the result in to the value pointed to by form.
+type DecodeFunc func(req *http.Request, form Form) error
+
+// decoders maps media types to registered body decoders.
+var decoders = struct {
+	sync.RWMutex
+	m map[string]DecodeFunc
+}{m: make(map[string]DecodeFunc)}
+
+// RegisterDecoder registers the decoder used by Validate for request
+// bodies of the given media type. Registered decoders take precedence
+// over the built in decoders.
+func RegisterDecoder(mediaType string, fn DecodeFunc) {
+	decoders.Lock()
+	defer decoders.Unlock()
+	decoders.m[mediaType] = fn
+}
+
+// FallbackDecoder is the decoder used by Validate for request bodies
+// of a media type that is neither registered nor built in. It defaults
+// to ValidateForm. Set it to RejectUnsupported to reply to unknown media
+// types with http.StatusUnsupportedMediaType instead.
+var FallbackDecoder DecodeFunc = ValidateForm
+
+// RejectUnsupported is a DecodeFunc that returns ErrUnsupportedMediaType.
+func RejectUnsupported(req *http.Request, form Form) error {
+	return ErrUnsupportedMediaType
+}
+
 // Validate decodes, sanitizes and validates the request body
 // and stores the result in to the value pointed to by form.
+// Unknown media types are decoded by FallbackDecoder. JSON and
+// XML bodies declared in a charset other than UTF-8 are
+// transcoded to UTF-8, or ErrUnsupportedCharset is returned.
 func Validate(req *http.Request, form Form) error {
 	v := req.Header.Get("Content-Type")
-	media, _, err := mime.ParseMediaType(v)
+	media, params, err := mime.ParseMediaType(v)
 	if err != nil {
 		return err
 	}
+	decoders.RLock()
+	fn, ok := decoders.m[media]
+	decoders.RUnlock()
+	if ok {
+		return fn(req, form)
+	}
 	switch media {
 	case "application/json":
+		err = transcodeBody(req, params["charset"])
+		if err != nil {
+			return err
+		}
 		return ValidateJSON(req, form)
 	case "multipart/form-data":
 		return ValidateMultipart(req, form)
+	case "application/xml", "text/xml":
+		err = transcodeBody(req, params["charset"])
+		if err != nil {
+			return err
+		}
+		return validateXML(req, form, params["charset"] != "")
 	}
-	return ValidateForm(req, form)
+	return FallbackDecoder(req, form)
 }
 
 // decoder decodes a struct with form values.
@@ -43,50 +165,489 @@ var decoder = schema.NewDecoder()
 
 // ValidateForm decodes, sanitizes and validates the request
 // body as a form and stores the result in the value pointed
-// to by form.
+// to by form. Forms submitted in a charset other than UTF-8,
+// as declared by the Content-Type charset parameter or the
+// _charset_ form field, are transcoded to UTF-8.
 func ValidateForm(req *http.Request, form Form) error {
 	err := req.ParseForm()
 	if err != nil {
 		return err
 	}
+	err = transcodeForm(req)
+	if err != nil {
+		return err
+	}
 	err = decoder.Decode(form, req.PostForm)
 	if err != nil {
 		return err
 	}
-	return form.Validate()
+	return validate(form)
+}
+
+// DecodeQuery decodes the request URL query into the value pointed to
+// by v with the same decoder and struct tags as ValidateForm. Repeated
+// keys are decoded into slice fields. Unknown keys, such as tracking
+// parameters, are ignored. If v implements Form, the result is sanitized
+// and validated.
+func DecodeQuery(req *http.Request, v interface{}) error {
+	err := ignoreUnknownKeys(decoder.Decode(v, req.URL.Query()))
+	if err != nil {
+		return err
+	}
+	form, ok := v.(Form)
+	if ok {
+		return validate(form)
+	}
+	return nil
+}
+
+// ignoreUnknownKeys returns err without the errors of unknown keys.
+func ignoreUnknownKeys(err error) error {
+	var me schema.MultiError
+	if !errors.As(err, &me) {
+		return err
+	}
+	known := make(schema.MultiError, len(me))
+	for k, err := range me {
+		var uke schema.UnknownKeyError
+		if !errors.As(err, &uke) {
+			known[k] = err
+		}
+	}
+	if len(known) == 0 {
+		return nil
+	}
+	return known
+}
+
+// transcodeForm transcodes the parsed form values of the request
+// from the declared form charset to UTF-8 and removes the _charset_
+// form field. The charset defaults to UTF-8 when unspecified.
+func transcodeForm(req *http.Request) error {
+	_, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	charset := params["charset"]
+	if charset == "" {
+		charset = req.PostForm.Get("_charset_")
+	}
+	req.PostForm.Del("_charset_")
+	if charset == "" {
+		return nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return fmt.Errorf("%w %q", ErrUnsupportedCharset, charset)
+	}
+	if enc == unicode.UTF8 {
+		return nil
+	}
+	dec := enc.NewDecoder()
+	values := make(url.Values, len(req.PostForm))
+	for k, vs := range req.PostForm {
+		key, err := dec.String(k)
+		if err != nil {
+			return err
+		}
+		for _, v := range vs {
+			v, err = dec.String(v)
+			if err != nil {
+				return err
+			}
+			values[key] = append(values[key], v)
+		}
+	}
+	req.PostForm = values
+	return nil
+}
+
+// transcodeBody replaces the request body with a reader transcoding
+// the body from charset, or the encoding of its byte order mark, to
+// UTF-8. The body is left as is if the charset is UTF-8 or unspecified.
+func transcodeBody(req *http.Request, charset string) error {
+	if charset == "" {
+		return nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return fmt.Errorf("%w %q", ErrUnsupportedCharset, charset)
+	}
+	if enc == unicode.UTF8 {
+		return nil
+	}
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{transform.NewReader(req.Body, unicode.BOMOverride(enc.NewDecoder())), req.Body}
+	return nil
 }
 
+// MaxJSONKeys is the maximum total number of object keys accepted by
+// ValidateJSON, guarding against bodies with many keys causing excessive
+// allocation when decoded into maps. If zero, the keys are not counted.
+var MaxJSONKeys = 10000
+
 // ValidateJSON decodes, sanitizes and validates the request
 // body as JSON and stores the result in the value pointed
-// to by form.
+// to by form. The request body is limited to DefaultMaxBodySize,
+// or the MaxBodySize of a form implementing BodySizeForm, and
+// ErrBodyTooLarge is returned if it is exceeded. ErrTooManyKeys
+// is returned if the body has more than MaxJSONKeys object keys
+// and ErrTrailingData if the value is followed by other data.
 func ValidateJSON(req *http.Request, form Form) error {
 	defer req.Body.Close()
-	err := json.NewDecoder(req.Body).Decode(form)
+	body := http.MaxBytesReader(nil, req.Body, maxBodySize(form))
+	if MaxJSONKeys <= 0 {
+		err := decodeJSON(body, form)
+		if err != nil {
+			return bodyError(err)
+		}
+		return validate(form)
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return bodyError(err)
+	}
+	err = countJSONKeys(b, MaxJSONKeys)
 	if err != nil {
 		return err
 	}
-	return form.Validate()
+	err = decodeJSON(bytes.NewReader(b), form)
+	if err != nil {
+		return err
+	}
+	return validate(form)
+}
+
+// DisallowUnknownFields causes ValidateJSON and ValidateNDJSON to return
+// an error wrapping ErrUnknownField if the body has an object key that
+// does not match any non-ignored, exported field of the form.
+var DisallowUnknownFields bool
+
+// decodeJSON decodes the JSON value of r into the value pointed to by v.
+// ErrTrailingData is returned if the value is followed by anything other
+// than white space.
+func decodeJSON(r io.Reader, v interface{}) error {
+	dec := NewDecoder(r)
+	if DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	err := dec.Decode(v)
+	if err != nil {
+		ud, ok := dec.(UnknownFieldDecoder)
+		if ok && DisallowUnknownFields {
+			name, ok := ud.UnknownField(err)
+			if ok {
+				return fmt.Errorf("%w: %s", ErrUnknownField, name)
+			}
+		}
+		return err
+	}
+	var extra json.RawMessage
+	err = dec.Decode(&extra)
+	if err == io.EOF {
+		return nil
+	}
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return err
+	}
+	return ErrTrailingData
+}
+
+// countJSONKeys scans the tokens of the leading JSON value of b and
+// returns ErrTooManyKeys if the total number of object keys exceeds max.
+func countJSONKeys(b []byte, max int) error {
+	type frame struct {
+		object    bool
+		expectKey bool
+	}
+	var stack []*frame
+	n := 0
+	dec := json.NewDecoder(bytes.NewReader(b))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return nil
+			}
+			continue
+		}
+		var top *frame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+		if top != nil && top.object && top.expectKey {
+			n++
+			if n > max {
+				return ErrTooManyKeys
+			}
+			top.expectKey = false
+			continue
+		}
+		if top != nil && top.object {
+			top.expectKey = true
+		}
+		switch tok {
+		case json.Delim('{'):
+			stack = append(stack, &frame{object: true, expectKey: true})
+		case json.Delim('['):
+			stack = append(stack, &frame{})
+		}
+		if len(stack) == 0 {
+			return nil
+		}
+	}
+}
+
+// TeeJSON decodes the leading JSON value of the request body into the
+// value pointed to by v while writing the raw body to w, such as an
+// upstream connection, so that a gateway may peek at a few fields of a
+// body it forwards without buffering it. The bytes read to decode v are
+// limited to DefaultMaxBodySize. The remainder of the body is copied to
+// w once v is decoded, so the entire body is written to w on success.
+func TeeJSON(req *http.Request, v interface{}, w io.Writer) error {
+	defer req.Body.Close()
+	peek := http.MaxBytesReader(nil, io.NopCloser(io.TeeReader(req.Body, w)), DefaultMaxBodySize)
+	err := NewDecoder(peek).Decode(v)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, req.Body)
+	return err
+}
+
+// ValidateNDJSON decodes, sanitizes and validates the request body as
+// newline delimited JSON. Each line is decoded into a new form returned
+// by newForm, validated and passed to each. The body is streamed so
+// that only one line is held in memory at a time, and each line is
+// limited to DefaultMaxBodySize. Errors are annotated with the line number.
+func ValidateNDJSON(req *http.Request, newForm func() Form, each func(Form) error) error {
+	defer req.Body.Close()
+	s := bufio.NewScanner(req.Body)
+	s.Buffer(nil, int(DefaultMaxBodySize))
+	n := 0
+	for s.Scan() {
+		n++
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		form := newForm()
+		err := decodeJSON(bytes.NewReader(line), form)
+		if err == nil {
+			err = validate(form)
+		}
+		if err == nil {
+			err = each(form)
+		}
+		if err != nil {
+			return fmt.Errorf("httpc: ndjson line %d: %w", n, err)
+		}
+	}
+	err := s.Err()
+	if err != nil {
+		return fmt.Errorf("httpc: ndjson line %d: %w", n+1, err)
+	}
+	return nil
+}
+
+// DefaultMaxBodySize is the default maximum request body size in bytes.
+const DefaultMaxBodySize int64 = 1 << 20 // 1 MB
+
+// ValidateXML decodes, sanitizes and validates the request
+// body as XML and stores the result in the value pointed
+// to by form. The request body is limited to DefaultMaxBodySize,
+// or the MaxBodySize of a form implementing BodySizeForm, and
+// ErrBodyTooLarge is returned if it is exceeded. Bodies declaring
+// an encoding other than UTF-8 in the XML declaration are transcoded
+// to UTF-8, or ErrUnsupportedCharset is returned.
+func ValidateXML(req *http.Request, form Form) error {
+	return validateXML(req, form, false)
+}
+
+// validateXML implements ValidateXML. If utf8 is true, the body has been
+// transcoded to UTF-8 from the charset of the Content-Type header, which
+// takes precedence over the encoding of the XML declaration.
+func validateXML(req *http.Request, form Form, utf8 bool) error {
+	defer req.Body.Close()
+	body := http.MaxBytesReader(nil, req.Body, maxBodySize(form))
+	dec := xml.NewDecoder(body)
+	dec.CharsetReader = func(charset string, r io.Reader) (io.Reader, error) {
+		if utf8 {
+			return r, nil
+		}
+		enc, err := htmlindex.Get(charset)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q", ErrUnsupportedCharset, charset)
+		}
+		return enc.NewDecoder().Reader(r), nil
+	}
+	err := dec.Decode(form)
+	if err != nil {
+		return bodyError(err)
+	}
+	return validate(form)
 }
 
 // DefaultMaxUploadSize is the default maximum file upload size in bytes.
 const DefaultMaxUploadSize int64 = 32 << 20 // 32 MB
 
+// MaxMultipartParts is the maximum number of value and file parts
+// accepted by ValidateMultipart. Bodies with many tiny parts can
+// exhaust resources even under the maximum upload size.
+var MaxMultipartParts = 1000
+
 // ValidateMultipart decodes, sanitizes and validates the request
 // body as multipart/form-data and stores the result in the value
-// pointed to by form.
+// pointed to by form. ErrTooManyParts is returned if the body
+// contains more than MaxMultipartParts parts. ErrUploadTooLarge
+// is returned if the form implements TotalUploadForm and the
+// combined size of the uploaded files exceeds its maximum.
 func ValidateMultipart(req *http.Request, form Form) error {
 	maxUploadSize := DefaultMaxUploadSize
 	uf, ok := form.(UploadForm)
 	if ok {
 		maxUploadSize = uf.MaxUploadSize()
 	}
-	err := req.ParseMultipartForm(maxUploadSize)
+	err := parseMultipartForm(req, maxUploadSize)
 	if err != nil {
 		return err
 	}
+	tf, ok := form.(TotalUploadForm)
+	if ok {
+		var size int64
+		for _, v := range req.MultipartForm.File {
+			for _, fh := range v {
+				size += fh.Size
+			}
+		}
+		if size > tf.MaxTotalUploadSize() {
+			req.MultipartForm.RemoveAll()
+			return ErrUploadTooLarge
+		}
+	}
 	err = decoder.Decode(form, req.MultipartForm.Value)
 	if err != nil {
 		return err
 	}
-	return form.Validate()
+	return validate(form)
+}
+
+// parseMultipartForm parses the request body as multipart/form-data the
+// same as req.ParseMultipartForm, except that the part delimiters are
+// counted as the body is read and parsing stops with ErrTooManyParts as
+// soon as the body exceeds MaxMultipartParts.
+func parseMultipartForm(req *http.Request, maxMemory int64) error {
+	if req.MultipartForm != nil {
+		return nil
+	}
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return http.ErrNotMultipart
+	}
+	body := req.Body
+	req.Body = &partCounter{ReadCloser: body, delim: []byte("\n--" + params["boundary"]), tail: []byte("\n")}
+	err = req.ParseMultipartForm(maxMemory)
+	req.Body = body
+	if errors.Is(err, ErrTooManyParts) {
+		if req.MultipartForm != nil {
+			req.MultipartForm.RemoveAll()
+			req.MultipartForm = nil
+		}
+		return ErrTooManyParts
+	}
+	return err
+}
+
+// partCounter is an io.ReadCloser that counts the multipart delimiters
+// read from the request body, returning ErrTooManyParts once the delimiters exceed those of
+// MaxMultipartParts parts and the closing delimiter.
+type partCounter struct {
+	io.ReadCloser
+	delim []byte
+	tail  []byte // last bytes read, shorter than delim
+	n     int
+}
+
+// Read implements the io.Reader interface.
+func (c *partCounter) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if n == 0 {
+		return n, err
+	}
+	b := p[:n]
+	k := len(c.delim) - 1
+	// Delimiters spanning the previous read are only matched
+	// across the tail and the first bytes of this read.
+	span := append(c.tail, b[:min(n, k)]...)
+	c.n += bytes.Count(span, c.delim) + bytes.Count(b, c.delim)
+	if len(span) > k {
+		span = span[len(span)-k:]
+	}
+	c.tail = append(c.tail[:0], span...)
+	if c.n > MaxMultipartParts+1 {
+		return 0, ErrTooManyParts
+	}
+	return n, err
+}
+
+// StreamMultipart decodes, sanitizes and validates the request body as
+// multipart/form-data without buffering file parts in memory or on disk.
+// Each file part is passed to fn in the order received, letting the
+// caller stream it to its destination. Value parts are decoded into the
+// value pointed to by form once the body has been read, so form values
+// are not available to fn. The total size of the value parts is limited
+// to DefaultMaxBodySize and the number of parts to MaxMultipartParts.
+func StreamMultipart(req *http.Request, form Form, fn func(part *multipart.Part) error) error {
+	mr, err := req.MultipartReader()
+	if err != nil {
+		return err
+	}
+	values := make(url.Values)
+	remaining := DefaultMaxBodySize
+	n := 0
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		n++
+		if n > MaxMultipartParts {
+			part.Close()
+			return ErrTooManyParts
+		}
+		if part.FileName() != "" {
+			err = fn(part)
+			part.Close()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		b, err := io.ReadAll(io.LimitReader(part, remaining+1))
+		part.Close()
+		if err != nil {
+			return err
+		}
+		remaining -= int64(len(b))
+		if remaining < 0 {
+			return &http.MaxBytesError{Limit: DefaultMaxBodySize}
+		}
+		values.Add(part.FormName(), string(b))
+	}
+	err = decoder.Decode(form, values)
+	if err != nil {
+		return err
+	}
+	return validate(form)
 }
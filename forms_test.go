@@ -1,16 +1,23 @@
 package httpc
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 type testForm struct {
-	Foo string `json:"foo"`
-	Bar int    `json:"bar"`
+	Foo string `json:"foo" xml:"foo"`
+	Bar int    `json:"bar" xml:"bar"`
 }
 
 func (f testForm) Validate() error {
@@ -20,6 +27,91 @@ func (f testForm) Validate() error {
 	return nil
 }
 
+func TestValidateFormCharset(t *testing.T) {
+	tests := map[string]struct {
+		contentType string
+		body        string
+		want        string
+		isValid     bool
+	}{
+		"utf-8":         {"application/x-www-form-urlencoded", "Foo=caf%C3%A9&Bar=1", "café", true},
+		"content type":  {"application/x-www-form-urlencoded; charset=windows-1252", "Foo=caf%E9&Bar=1", "café", true},
+		"charset field": {"application/x-www-form-urlencoded", "_charset_=windows-1252&Foo=caf%E9&Bar=1", "café", true},
+		"utf-8 field":   {"application/x-www-form-urlencoded", "_charset_=UTF-8&Foo=caf%C3%A9&Bar=1", "café", true},
+		"latin1 alias":  {"application/x-www-form-urlencoded; charset=iso-8859-1", "Foo=%C0+la+carte&Bar=1", "À la carte", true},
+		"unsupported":   {"application/x-www-form-urlencoded; charset=x-unknown", "Foo=bar&Bar=1", "", false},
+	}
+	for name, tt := range tests {
+		var form testForm
+		req := testRequest(t, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		err := ValidateForm(req, &form)
+		switch {
+		case tt.isValid && err != nil:
+			t.Errorf("TestValidateFormCharset %s: %v", name, err)
+		case !tt.isValid && err == nil:
+			t.Errorf("TestValidateFormCharset %s: expected error", name)
+		case tt.isValid && form.Foo != tt.want:
+			t.Errorf("TestValidateFormCharset %s: Foo %q, expected %q", name, form.Foo, tt.want)
+		}
+	}
+}
+
+type testFieldForm struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+func (f testFieldForm) Validate() error {
+	return nil
+}
+
+func (f testFieldForm) ValidateFields() map[string]error {
+	fields := make(map[string]error)
+	if f.Name == "" {
+		fields["name"] = errors.New("required")
+	}
+	_, err := ValidateEmail(f.Email)
+	if err != nil {
+		fields["email"] = err
+	}
+	return fields
+}
+
+func TestValidateFields(t *testing.T) {
+	var form testFieldForm
+	req := testRequest(t, strings.NewReader(`{"name":"","email":"invalid"}`))
+	req.Header.Set("Content-Type", "application/json")
+	err := Validate(req, &form)
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("TestValidateFields: %v, expected *ValidationError", err)
+	}
+	if len(ve.Fields) != 2 {
+		t.Errorf("TestValidateFields: %d fields, expected 2", len(ve.Fields))
+	}
+	want := "httpc: invalid fields: email: httpc: invalid email address; name: required"
+	if ve.Error() != want {
+		t.Errorf("TestValidateFields: %q, expected %q", ve.Error(), want)
+	}
+	b, err := json.Marshal(ve)
+	if err != nil {
+		t.Fatalf("TestValidateFields: %v", err)
+	}
+	if string(b) != `{"fields":{"email":"httpc: invalid email address","name":"required"}}` {
+		t.Errorf("TestValidateFields: %s", b)
+	}
+	if statusCode(ve) != http.StatusUnprocessableEntity {
+		t.Errorf("TestValidateFields: status %d", statusCode(ve))
+	}
+	req = testRequest(t, strings.NewReader(`{"name":"foo","email":"foo@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	err = Validate(req, &form)
+	if err != nil {
+		t.Errorf("TestValidateFields valid: %v", err)
+	}
+}
+
 func TestValidateJSON(t *testing.T) {
 	tests := map[string]struct {
 		body    string
@@ -41,6 +133,629 @@ func TestValidateJSON(t *testing.T) {
 	}
 }
 
+type testMapForm map[string]interface{}
+
+func (f testMapForm) Validate() error {
+	return nil
+}
+
+func TestValidateJSONMaxKeys(t *testing.T) {
+	defer func(n int) { MaxJSONKeys = n }(MaxJSONKeys)
+	MaxJSONKeys = 4
+	tests := map[string]struct {
+		body string
+		err  error
+	}{
+		"under limit":   {`{"a":1,"b":2,"c":3}`, nil},
+		"at limit":      {`{"a":{"b":[{"c":1}]},"d":"e"}`, nil},
+		"over limit":    {`{"a":1,"b":2,"c":3,"d":4,"e":5}`, ErrTooManyKeys},
+		"over nested":   {`{"a":[{"b":1},{"c":2},{"d":3},{"e":4}]}`, ErrTooManyKeys},
+		"string values": {`{"a":"b","c":"d","e":"f","g":"h"}`, nil},
+	}
+	for name, tt := range tests {
+		form := make(testMapForm)
+		req := testRequest(t, strings.NewReader(tt.body))
+		err := ValidateJSON(req, &form)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("TestValidateJSONMaxKeys %s: %v, expected %v", name, err, tt.err)
+		}
+	}
+	if statusCode(ErrTooManyKeys) != http.StatusBadRequest {
+		t.Errorf("TestValidateJSONMaxKeys: status %d", statusCode(ErrTooManyKeys))
+	}
+}
+
+func TestValidateXML(t *testing.T) {
+	tests := map[string]struct {
+		body    string
+		isValid bool
+	}{
+		"valid":     {`<form><foo>bar</foo><bar>1</bar></form>`, true},
+		"invalid":   {`<form><foo>bar</foo><bar>0</bar></form>`, false},
+		"malformed": {`<form><foo>bar</foo>`, false},
+		"too large": {`<form><foo>` + strings.Repeat("a", int(DefaultMaxBodySize)) + `</foo><bar>1</bar></form>`, false},
+	}
+	for name, tt := range tests {
+		var form testForm
+		req := testRequest(t, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+		err := Validate(req, &form)
+		switch {
+		case tt.isValid && err != nil:
+			t.Errorf("TestValidateXML %s: %v", name, err)
+		case !tt.isValid && err == nil:
+			t.Errorf("TestValidateXML %s: expected error", name)
+		case tt.isValid && form.Foo != "bar":
+			t.Errorf("TestValidateXML %s: Foo %q", name, form.Foo)
+		}
+	}
+}
+
+func TestTeeJSON(t *testing.T) {
+	tests := map[string]struct {
+		body    string
+		isValid bool
+	}{
+		"small":     {`{"foo":"bar","bar":1}`, true},
+		"large":     {`{"foo":"bar","bar":1,"baz":"` + strings.Repeat("a", 64<<10) + `"}`, true},
+		"malformed": {`{"foo":`, false},
+		"too large": {`{"baz":"` + strings.Repeat("a", int(DefaultMaxBodySize)) + `","foo":"bar"}`, false},
+	}
+	for name, tt := range tests {
+		var form testForm
+		var buf bytes.Buffer
+		req := testRequest(t, strings.NewReader(tt.body))
+		err := TeeJSON(req, &form, &buf)
+		switch {
+		case tt.isValid && err != nil:
+			t.Errorf("TestTeeJSON %s: %v", name, err)
+		case !tt.isValid && err == nil:
+			t.Errorf("TestTeeJSON %s: expected error", name)
+		case tt.isValid && form.Foo != "bar":
+			t.Errorf("TestTeeJSON %s: Foo %q", name, form.Foo)
+		case tt.isValid && buf.String() != tt.body:
+			t.Errorf("TestTeeJSON %s: teed %d bytes, expected %d", name, buf.Len(), len(tt.body))
+		}
+	}
+}
+
+func TestValidateNDJSON(t *testing.T) {
+	body := `{"foo":"a","bar":1}
+{"foo":"b","bar":2}
+
+{"foo":"c","bar":0}
+{"foo":"d","bar":4}
+`
+	var seen []string
+	req := testRequest(t, strings.NewReader(body))
+	err := ValidateNDJSON(req, func() Form { return &testForm{} }, func(form Form) error {
+		seen = append(seen, form.(*testForm).Foo)
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("TestValidateNDJSON: error %v, expected line 4", err)
+	}
+	if strings.Join(seen, ",") != "a,b" {
+		t.Errorf("TestValidateNDJSON: seen %v, expected [a b]", seen)
+	}
+}
+
+func TestRegisterDecoder(t *testing.T) {
+	RegisterDecoder("text/x-test", func(req *http.Request, form Form) error {
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		f := form.(*testForm)
+		f.Foo = string(b)
+		f.Bar = len(b)
+		return form.Validate()
+	})
+	defer func() {
+		decoders.Lock()
+		delete(decoders.m, "text/x-test")
+		decoders.Unlock()
+	}()
+	var form testForm
+	req := testRequest(t, strings.NewReader("hello"))
+	req.Header.Set("Content-Type", "text/x-test; charset=utf-8")
+	err := Validate(req, &form)
+	if err != nil {
+		t.Fatalf("TestRegisterDecoder: %v", err)
+	}
+	if form.Foo != "hello" || form.Bar != 5 {
+		t.Errorf("TestRegisterDecoder: form %+v", form)
+	}
+}
+
+func TestValidateCharset(t *testing.T) {
+	utf16 := []byte{0xff, 0xfe}
+	for _, r := range `{"foo":"café","bar":1}` {
+		utf16 = append(utf16, byte(r), byte(r>>8))
+	}
+	tests := map[string]struct {
+		contentType string
+		body        []byte
+		want        string
+		err         error
+	}{
+		"missing":      {"application/json", []byte(`{"foo":"café","bar":1}`), "café", nil},
+		"utf-8":        {"application/json; charset=utf-8", []byte(`{"foo":"café","bar":1}`), "café", nil},
+		"utf-8 alias":  {"application/json; charset=UTF8", []byte(`{"foo":"café","bar":1}`), "café", nil},
+		"latin1":       {"application/json; charset=iso-8859-1", []byte("{\"foo\":\"caf\xe9\",\"bar\":1}"), "café", nil},
+		"utf-16":       {"application/json; charset=utf-16", utf16, "café", nil},
+		"xml latin1":   {"application/xml; charset=windows-1252", []byte("<testForm><foo>caf\xe9</foo><bar>1</bar></testForm>"), "café", nil},
+		"xml decl":     {"application/xml", []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><testForm><foo>caf\xe9</foo><bar>1</bar></testForm>"), "café", nil},
+		"xml decl hdr": {"application/xml; charset=iso-8859-1", []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><testForm><foo>caf\xe9</foo><bar>1</bar></testForm>"), "café", nil},
+		"xml decl utf": {"text/xml; charset=utf-8", []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><testForm><foo>café</foo><bar>1</bar></testForm>"), "café", nil},
+		"xml decl unk": {"application/xml", []byte("<?xml version=\"1.0\" encoding=\"x-unknown\"?><testForm/>"), "", ErrUnsupportedCharset},
+		"unsupported":  {"application/json; charset=x-unknown", []byte(`{"foo":"a","bar":1}`), "", ErrUnsupportedCharset},
+		"xml unknown":  {"text/xml; charset=x-unknown", []byte(`<testForm/>`), "", ErrUnsupportedCharset},
+		"form unknown": {"application/x-www-form-urlencoded; charset=x-unknown", []byte("Foo=a&Bar=1"), "", ErrUnsupportedCharset},
+	}
+	for name, tt := range tests {
+		var form testForm
+		req := testRequest(t, bytes.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		err := Validate(req, &form)
+		if !errors.Is(err, tt.err) || (err == nil) != (tt.err == nil) {
+			t.Errorf("TestValidateCharset %s: %v, expected %v", name, err, tt.err)
+			continue
+		}
+		if err != nil && statusCode(err) != http.StatusUnsupportedMediaType {
+			t.Errorf("TestValidateCharset %s: status %d", name, statusCode(err))
+		}
+		if form.Foo != tt.want {
+			t.Errorf("TestValidateCharset %s: %q, expected %q", name, form.Foo, tt.want)
+		}
+	}
+}
+
+func TestFallbackDecoder(t *testing.T) {
+	defer func(fn DecodeFunc) { FallbackDecoder = fn }(FallbackDecoder)
+	tests := map[string]struct {
+		fallback DecodeFunc
+		err      string
+		form     testForm
+	}{
+		"default": {nil, "f.Bar < 1", testForm{}},
+		"reject":  {RejectUnsupported, ErrUnsupportedMediaType.Error(), testForm{}},
+		"verbatim": {func(req *http.Request, form Form) error {
+			b, err := io.ReadAll(req.Body)
+			if err != nil {
+				return err
+			}
+			form.(*testForm).Foo = string(b)
+			return nil
+		}, "", testForm{Foo: "Foo=a&Bar=1"}},
+	}
+	for name, tt := range tests {
+		FallbackDecoder = ValidateForm
+		if tt.fallback != nil {
+			FallbackDecoder = tt.fallback
+		}
+		var form testForm
+		req := testRequest(t, strings.NewReader("Foo=a&Bar=1"))
+		req.Header.Set("Content-Type", "text/plain")
+		err := Validate(req, &form)
+		var msg string
+		if err != nil {
+			msg = err.Error()
+		}
+		if msg != tt.err {
+			t.Errorf("TestFallbackDecoder %s: error %q, expected %q", name, msg, tt.err)
+		}
+		if form != tt.form {
+			t.Errorf("TestFallbackDecoder %s: form %+v, expected %+v", name, form, tt.form)
+		}
+	}
+	req := testRequest(t, strings.NewReader("Foo=a&Bar=1"))
+	req.Header.Set("Content-Type", "text/plain")
+	FallbackDecoder = RejectUnsupported
+	code := statusCode(Validate(req, &testForm{}))
+	if code != http.StatusUnsupportedMediaType {
+		t.Errorf("TestFallbackDecoder: status %d, expected %d", code, http.StatusUnsupportedMediaType)
+	}
+}
+
+type testSizedForm struct {
+	testForm
+}
+
+func (f testSizedForm) MaxBodySize() int64 {
+	return 32
+}
+
+func TestValidateJSONMaxBodySize(t *testing.T) {
+	defer func(n int) { MaxJSONKeys = n }(MaxJSONKeys)
+	large := `{"foo":"` + strings.Repeat("a", int(DefaultMaxBodySize)) + `","bar":1}`
+	tests := map[string]struct {
+		body  string
+		form  Form
+		keys  int
+		err   error
+		valid bool
+	}{
+		"small":          {`{"foo":"a","bar":1}`, &testForm{}, 10, nil, true},
+		"oversized":      {large, &testForm{}, 10, ErrBodyTooLarge, false},
+		"stream":         {large, &testForm{}, 0, ErrBodyTooLarge, false},
+		"form limit":     {`{"foo":"` + strings.Repeat("a", 32) + `","bar":1}`, &testSizedForm{}, 10, ErrBodyTooLarge, false},
+		"form limit fit": {`{"foo":"a","bar":1}`, &testSizedForm{}, 10, nil, true},
+	}
+	for name, tt := range tests {
+		MaxJSONKeys = tt.keys
+		req := testRequest(t, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		err := Validate(req, tt.form)
+		if (err == nil) != tt.valid {
+			t.Errorf("TestValidateJSONMaxBodySize %s: error %v", name, err)
+			continue
+		}
+		if tt.err != nil && err != tt.err {
+			t.Errorf("TestValidateJSONMaxBodySize %s: error %v, expected %v", name, err, tt.err)
+		}
+		if tt.err != nil && statusCode(err) != http.StatusRequestEntityTooLarge {
+			t.Errorf("TestValidateJSONMaxBodySize %s: status %d, expected %d", name, statusCode(err), http.StatusRequestEntityTooLarge)
+		}
+	}
+}
+
+func TestValidateXMLMaxBodySize(t *testing.T) {
+	tests := map[string]struct {
+		body  string
+		form  Form
+		err   error
+		valid bool
+	}{
+		"small":          {`<form><foo>a</foo><bar>1</bar></form>`, &testForm{}, nil, true},
+		"oversized":      {`<form><foo>` + strings.Repeat("a", int(DefaultMaxBodySize)) + `</foo><bar>1</bar></form>`, &testForm{}, ErrBodyTooLarge, false},
+		"form limit":     {`<form><foo>` + strings.Repeat("a", 32) + `</foo><bar>1</bar></form>`, &testSizedForm{}, ErrBodyTooLarge, false},
+		"form limit fit": {`<form><bar>1</bar></form>`, &testSizedForm{}, nil, true},
+	}
+	for name, tt := range tests {
+		req := testRequest(t, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/xml")
+		err := Validate(req, tt.form)
+		if (err == nil) != tt.valid {
+			t.Errorf("TestValidateXMLMaxBodySize %s: error %v", name, err)
+			continue
+		}
+		if tt.err != nil && err != tt.err {
+			t.Errorf("TestValidateXMLMaxBodySize %s: error %v, expected %v", name, err, tt.err)
+		}
+		if tt.err != nil && statusCode(err) != http.StatusRequestEntityTooLarge {
+			t.Errorf("TestValidateXMLMaxBodySize %s: status %d, expected %d", name, statusCode(err), http.StatusRequestEntityTooLarge)
+		}
+	}
+}
+
+func TestValidateJSONStrict(t *testing.T) {
+	defer func(v bool) { DisallowUnknownFields = v }(DisallowUnknownFields)
+	defer func(n int) { MaxJSONKeys = n }(MaxJSONKeys)
+	tests := map[string]struct {
+		body     string
+		disallow bool
+		err      error
+	}{
+		"valid":              {`{"foo":"a","bar":1}`, false, nil},
+		"unknown allowed":    {`{"foo":"a","bar":1,"baz":true}`, false, nil},
+		"unknown disallowed": {`{"foo":"a","bar":1,"baz":true}`, true, ErrUnknownField},
+		"known disallowed":   {`{"foo":"a","bar":1}`, true, nil},
+		"trailing space":     {"{\"foo\":\"a\",\"bar\":1}\n ", false, nil},
+		"trailing value":     {`{"foo":"a","bar":1} {"bar":2}`, false, ErrTrailingData},
+		"trailing garbage":   {`{"foo":"a","bar":1}garbage`, false, ErrTrailingData},
+		"trailing delim":     {`{"foo":"a","bar":1}}`, false, ErrTrailingData},
+	}
+	for _, keys := range []int{MaxJSONKeys, 0} {
+		MaxJSONKeys = keys
+		for name, tt := range tests {
+			DisallowUnknownFields = tt.disallow
+			var form testForm
+			req := testRequest(t, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			err := Validate(req, &form)
+			if !errors.Is(err, tt.err) || (err == nil) != (tt.err == nil) {
+				t.Errorf("TestValidateJSONStrict %s (keys %d): %v, expected %v", name, keys, err, tt.err)
+				continue
+			}
+			if err != nil && statusCode(err) != http.StatusBadRequest {
+				t.Errorf("TestValidateJSONStrict %s (keys %d): status %d", name, keys, statusCode(err))
+			}
+			if errors.Is(err, ErrUnknownField) && !strings.HasSuffix(err.Error(), `: "baz"`) {
+				t.Errorf("TestValidateJSONStrict %s (keys %d): %v, expected field name", name, keys, err)
+			}
+		}
+	}
+}
+
+type testDecoder struct {
+	*json.Decoder
+	calls *int
+}
+
+func (d testDecoder) Decode(v interface{}) error {
+	*d.calls++
+	return d.Decoder.Decode(v)
+}
+
+func TestNewDecoder(t *testing.T) {
+	defer func(fn func(io.Reader) Decoder) { NewDecoder = fn }(NewDecoder)
+	calls := 0
+	NewDecoder = func(r io.Reader) Decoder {
+		return testDecoder{json.NewDecoder(r), &calls}
+	}
+	var form testForm
+	req := testRequest(t, strings.NewReader(`{"foo":"a","bar":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	err := Validate(req, &form)
+	if err != nil {
+		t.Fatalf("TestNewDecoder: %v", err)
+	}
+	if calls == 0 {
+		t.Errorf("TestNewDecoder: custom decoder not invoked")
+	}
+	if form.Foo != "a" || form.Bar != 1 {
+		t.Errorf("TestNewDecoder: %+v", form)
+	}
+}
+
+type testUnknownFieldError string
+
+func (e testUnknownFieldError) Error() string {
+	return "unknown " + string(e)
+}
+
+type testUnknownFieldDecoder struct {
+	Decoder
+}
+
+func (d testUnknownFieldDecoder) Decode(v interface{}) error {
+	return testUnknownFieldError("baz")
+}
+
+func (d testUnknownFieldDecoder) UnknownField(err error) (string, bool) {
+	var e testUnknownFieldError
+	if errors.As(err, &e) {
+		return string(e), true
+	}
+	return "", false
+}
+
+func TestNewDecoderUnknownField(t *testing.T) {
+	defer func(fn func(io.Reader) Decoder) { NewDecoder = fn }(NewDecoder)
+	defer func(v bool) { DisallowUnknownFields = v }(DisallowUnknownFields)
+	DisallowUnknownFields = true
+	NewDecoder = func(r io.Reader) Decoder {
+		return testUnknownFieldDecoder{newDecoder(r)}
+	}
+	var form testForm
+	req := testRequest(t, strings.NewReader(`{"baz":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	err := Validate(req, &form)
+	if !errors.Is(err, ErrUnknownField) || !strings.HasSuffix(err.Error(), ": baz") {
+		t.Errorf("TestNewDecoderUnknownField: %v, expected %v", err, ErrUnknownField)
+	}
+}
+
+type testQuery struct {
+	Page   int      `schema:"page"`
+	Active bool     `schema:"active"`
+	Tags   []string `schema:"tag"`
+	IDs    []int    `schema:"id"`
+}
+
+func TestDecodeQuery(t *testing.T) {
+	tests := map[string]struct {
+		query   string
+		want    testQuery
+		isValid bool
+	}{
+		"empty":    {"", testQuery{}, true},
+		"typed":    {"page=2&active=true", testQuery{Page: 2, Active: true}, true},
+		"repeated": {"tag=a&tag=b&id=1&id=2&id=3", testQuery{Tags: []string{"a", "b"}, IDs: []int{1, 2, 3}}, true},
+		"invalid":  {"page=x", testQuery{}, false},
+		"unknown":  {"page=2&utm_source=x", testQuery{Page: 2}, true},
+		"mixed":    {"page=x&utm_source=x", testQuery{}, false},
+	}
+	for name, tt := range tests {
+		var v testQuery
+		req := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+		err := DecodeQuery(req, &v)
+		if (err == nil) != tt.isValid {
+			t.Errorf("TestDecodeQuery %s: error %v", name, err)
+			continue
+		}
+		if tt.isValid && !reflect.DeepEqual(v, tt.want) {
+			t.Errorf("TestDecodeQuery %s: %+v, expected %+v", name, v, tt.want)
+		}
+	}
+}
+
+func TestDecodeQueryForm(t *testing.T) {
+	tests := map[string]struct {
+		query   string
+		isValid bool
+	}{
+		"valid":   {"Foo=a&Bar=1", true},
+		"invalid": {"Foo=a&Bar=0", false},
+	}
+	for name, tt := range tests {
+		var form testForm
+		req := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+		err := DecodeQuery(req, &form)
+		if (err == nil) != tt.isValid {
+			t.Errorf("TestDecodeQueryForm %s: error %v", name, err)
+		}
+	}
+}
+
+func TestValidateMultipartMaxParts(t *testing.T) {
+	defer func(n int) { MaxMultipartParts = n }(MaxMultipartParts)
+	MaxMultipartParts = 3
+	tests := map[string]struct {
+		parts   int
+		oneByte bool
+		err     error
+	}{
+		"under limit":         {2, false, nil},
+		"at limit":            {3, false, nil},
+		"over limit":          {4, false, ErrTooManyParts},
+		"at limit one byte":   {3, true, nil},
+		"over limit one byte": {4, true, ErrTooManyParts},
+	}
+	for name, tt := range tests {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("Bar", "1")
+		for i := 1; i < tt.parts; i++ {
+			mw.WriteField("Foo", "bar")
+		}
+		mw.Close()
+		var r io.Reader = &body
+		if tt.oneByte {
+			r = iotest.OneByteReader(r)
+		}
+		req := testRequest(t, r)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		var form testForm
+		err := ValidateMultipart(req, &form)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("TestValidateMultipartMaxParts %s: %v, expected %v", name, err, tt.err)
+		}
+	}
+	if statusCode(ErrTooManyParts) != http.StatusBadRequest {
+		t.Errorf("TestValidateMultipartMaxParts: status %d", statusCode(ErrTooManyParts))
+	}
+}
+
+func TestValidateMultipartMaxPartsStreaming(t *testing.T) {
+	defer func(n int) { MaxMultipartParts = n }(MaxMultipartParts)
+	MaxMultipartParts = 3
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("Bar", "1")
+	for i := 0; i < 5000; i++ {
+		fw, _ := mw.CreateFormFile("file", "f.txt")
+		fw.Write(bytes.Repeat([]byte("x"), 100))
+	}
+	mw.Close()
+	size := body.Len()
+	r := bytes.NewReader(body.Bytes())
+	req := testRequest(t, r)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	var form testForm
+	err := ValidateMultipart(req, &form)
+	if err != ErrTooManyParts {
+		t.Fatalf("TestValidateMultipartMaxPartsStreaming: %v, expected %v", err, ErrTooManyParts)
+	}
+	if read := size - r.Len(); read > size/10 {
+		t.Errorf("TestValidateMultipartMaxPartsStreaming: read %d of %d bytes before rejecting", read, size)
+	}
+}
+
+func TestValidateMultipartForm(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("Foo", "a")
+	mw.WriteField("Bar", "2")
+	fw, _ := mw.CreateFormFile("file", "f.txt")
+	fw.Write([]byte("content"))
+	mw.Close()
+	req := testRequest(t, &body)
+	req.URL.RawQuery = "q=1"
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	var form testForm
+	err := ValidateMultipart(req, &form)
+	if err != nil {
+		t.Fatalf("TestValidateMultipartForm: %v", err)
+	}
+	if form.Foo != "a" || form.Bar != 2 {
+		t.Errorf("TestValidateMultipartForm: %+v", form)
+	}
+	if req.FormValue("q") != "1" || req.PostFormValue("Foo") != "a" {
+		t.Errorf("TestValidateMultipartForm: form %v post form %v", req.Form, req.PostForm)
+	}
+	f, fh, err := req.FormFile("file")
+	if err != nil {
+		t.Fatalf("TestValidateMultipartForm: %v", err)
+	}
+	defer f.Close()
+	b, _ := io.ReadAll(f)
+	if fh.Filename != "f.txt" || string(b) != "content" {
+		t.Errorf("TestValidateMultipartForm: file %q %q", fh.Filename, b)
+	}
+}
+
+type testTotalUploadForm struct {
+	testForm
+}
+
+func (f testTotalUploadForm) MaxTotalUploadSize() int64 {
+	return 10
+}
+
+func TestValidateMultipartMaxTotalUploadSize(t *testing.T) {
+	tests := map[string]struct {
+		files []string
+		err   error
+	}{
+		"none":       {nil, nil},
+		"under":      {[]string{"abc", "def"}, nil},
+		"at limit":   {[]string{"abcde", "fghij"}, nil},
+		"over":       {[]string{"abcde", "fghij", "k"}, ErrUploadTooLarge},
+		"single big": {[]string{"abcdefghijk"}, ErrUploadTooLarge},
+	}
+	for name, tt := range tests {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("Bar", "1")
+		for i, content := range tt.files {
+			fw, _ := mw.CreateFormFile("file", fmt.Sprintf("%d.txt", i))
+			io.WriteString(fw, content)
+		}
+		mw.Close()
+		req := testRequest(t, &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		var form testTotalUploadForm
+		err := ValidateMultipart(req, &form)
+		if err != tt.err {
+			t.Errorf("TestValidateMultipartMaxTotalUploadSize %s: %v, expected %v", name, err, tt.err)
+		}
+	}
+	if statusCode(ErrUploadTooLarge) != http.StatusRequestEntityTooLarge {
+		t.Errorf("TestValidateMultipartMaxTotalUploadSize: status %d", statusCode(ErrUploadTooLarge))
+	}
+}
+
+func TestStreamMultipart(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("Foo", "bar")
+	fw, _ := mw.CreateFormFile("file", "hello.txt")
+	io.WriteString(fw, "hello, world")
+	mw.WriteField("Bar", "1")
+	mw.Close()
+	req := testRequest(t, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	var form testForm
+	var buf bytes.Buffer
+	var filename string
+	err := StreamMultipart(req, &form, func(part *multipart.Part) error {
+		filename = part.FileName()
+		_, err := io.Copy(&buf, part)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("TestStreamMultipart: %v", err)
+	}
+	if filename != "hello.txt" || buf.String() != "hello, world" {
+		t.Errorf("TestStreamMultipart: file %q %q", filename, buf.String())
+	}
+	if form.Foo != "bar" || form.Bar != 1 {
+		t.Errorf("TestStreamMultipart: form %+v", form)
+	}
+}
+
 func testRequest(t *testing.T, body io.Reader) *http.Request {
 	req, err := http.NewRequest(http.MethodPost, "http://localhost", body)
 	if err != nil {
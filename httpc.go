@@ -2,9 +2,18 @@
 package httpc
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"html"
+	"io"
+	"mime"
 	"net"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -12,19 +21,214 @@ import (
 type key int
 
 // Package context.Context keys.
-const keyError key = iota
+const (
+	keyError key = iota
+	keyRole
+	keyLogger
+	keyJSONOnly
+	keyPreflight
+	keyRequestID
+)
 
 // Abort replies to the request with a default plain text error.
 func Abort(w http.ResponseWriter, code int) error {
 	return RenderPlain(w, http.StatusText(code), code)
 }
 
+// AbortRequest replies to the request with a default error in the
+// format negotiated with the Accept header of the request, as a JSON
+// error object such as {"error": "Not Found", "status": 404}, an HTML
+// page or plain text. Requests without an Accept header or that do not
+// accept any of the formats are replied to with plain text, as with
+// Abort. Errors are always written as JSON for requests served by a
+// mux in JSON only mode.
+func AbortRequest(w http.ResponseWriter, req *http.Request, code int) error {
+	msg := http.StatusText(code)
+	media := "application/json"
+	if !isJSONOnly(req) {
+		media = bestOffer(parseAccept(req.Header.Get("Accept")), abortOffers)
+	}
+	switch media {
+	case "application/json":
+		return RenderJSON(w, jsonError{Error: msg, Status: code}, code)
+	case "text/html":
+		return RenderHTML(w, errorPage{Error: msg, Status: code}, code)
+	}
+	return Abort(w, code)
+}
+
+// abortOffers are the media types offered by AbortRequest in order
+// of preference when the Accept header does not distinguish them.
+var abortOffers = []string{"text/plain", "application/json", "text/html"}
+
+// errorPage is the HTML error page written by AbortRequest.
+type errorPage struct {
+	Error  string
+	Status int
+}
+
+// Render implements the Renderer interface.
+func (p errorPage) Render() ([]byte, error) {
+	msg := html.EscapeString(p.Error)
+	return []byte(fmt.Sprintf("<!DOCTYPE html>\n<title>%d %s</title>\n<h1>%s</h1>\n", p.Status, msg, msg)), nil
+}
+
 // NoContent writes http.StatusNoContent to the header.
 func NoContent(w http.ResponseWriter) error {
 	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
 
+// PutResult replies to a PUT request that created or replaced the
+// resource at the request URL. A created resource is replied to with
+// http.StatusCreated and a Location header of the request path, and a
+// replaced resource with http.StatusOK. The view is written with Render
+// unless it is nil or the request is a HEAD request, in which case only
+// the status is written, and a replaced resource without a view is
+// replied to with http.StatusNoContent.
+func PutResult(w http.ResponseWriter, req *http.Request, created bool, view Viewable) error {
+	code := http.StatusOK
+	if created {
+		code = http.StatusCreated
+		w.Header().Set("Location", req.URL.EscapedPath())
+	}
+	if view == nil && !created {
+		return NoContent(w)
+	}
+	if view == nil || req.Method == http.MethodHead {
+		w.WriteHeader(code)
+		return nil
+	}
+	return Render(w, req, view, code)
+}
+
+// NoStore sets the response headers that prevent browsers and proxies
+// from caching the response, such as for account pages and tokens.
+func NoStore(w http.ResponseWriter) {
+	h := w.Header()
+	h.Set("Cache-Control", "no-store, no-cache, must-revalidate")
+	h.Set("Pragma", "no-cache")
+	h.Set("Expires", "0")
+}
+
+// PaymentRequired replies to the request with http.StatusPaymentRequired.
+func PaymentRequired(w http.ResponseWriter) error {
+	return Abort(w, http.StatusPaymentRequired)
+}
+
+// UnavailableForLegalReasons replies to the request with
+// http.StatusUnavailableForLegalReasons. If blockedBy is not empty,
+// a Link header identifying the entity implementing the blockage is
+// set as described by RFC 7725.
+func UnavailableForLegalReasons(w http.ResponseWriter, blockedBy string) error {
+	if blockedBy != "" {
+		w.Header().Add("Link", "<"+blockedBy+">; rel=\"blocked-by\"")
+	}
+	return Abort(w, http.StatusUnavailableForLegalReasons)
+}
+
+// FullURL returns the absolute URL requested by the client, accounting
+// for the X-Forwarded-Proto and X-Forwarded-Host headers set by proxies.
+// The path is escaped and the query is included.
+//
+// FullURL trusts the forwarding headers of every client the same as
+// RemoteAddr. Use FullURLFrom to only trust the headers set by known
+// proxies.
+func FullURL(req *http.Request) string {
+	return FullURLFrom(req, trustAll)
+}
+
+// FullURLFrom returns the absolute URL requested by the client the same
+// as FullURL, honoring the forwarding headers only if the connection
+// remote address falls within one of the trusted networks.
+func FullURLFrom(req *http.Request, trusted []*net.IPNet) string {
+	forwarded := isTrusted(req.RemoteAddr, trusted)
+	u := url.URL{Scheme: scheme(req, forwarded), Host: host(req, forwarded)}
+	return u.String() + req.URL.RequestURI()
+}
+
+// scheme returns the request scheme, or that of the
+// X-Forwarded-Proto header if forwarded is true.
+func scheme(req *http.Request, forwarded bool) string {
+	if forwarded {
+		v, _, _ := strings.Cut(req.Header.Get("X-Forwarded-Proto"), ",")
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "http" || v == "https" {
+			return v
+		}
+	}
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// host returns the request host, or that of the
+// X-Forwarded-Host header if forwarded is true.
+func host(req *http.Request, forwarded bool) string {
+	if forwarded {
+		v, _, _ := strings.Cut(req.Header.Get("X-Forwarded-Host"), ",")
+		v = strings.TrimSpace(v)
+		if v != "" {
+			return v
+		}
+	}
+	return req.Host
+}
+
+// HasBody reports whether the request has a body without consuming it.
+func HasBody(req *http.Request) bool {
+	return req.ContentLength > 0 || (req.Body != nil && req.Body != http.NoBody)
+}
+
+// Continue decides whether to accept the request body based on the
+// request headers before the body is read. If accept returns an error,
+// the connection is marked to be closed and the error is returned for
+// the handler to return, so that a client sending Expect: 100-continue
+// is refused without uploading the body. Otherwise, if the client
+// expects it, an interim http.StatusContinue response is sent and
+// flushed with http.ResponseController. Sending an interim response
+// with WriteHeader requires Go 1.19 or later.
+func Continue(w http.ResponseWriter, req *http.Request, accept func(req *http.Request) error) error {
+	err := accept(req)
+	if err != nil {
+		w.Header().Set("Connection", "close")
+		return err
+	}
+	if strings.EqualFold(req.Header.Get("Expect"), "100-continue") {
+		w.WriteHeader(http.StatusContinue)
+		http.NewResponseController(w).Flush()
+	}
+	return nil
+}
+
+// MaxContentLength returns an accept function for Continue that
+// returns ErrBodyTooLarge if the declared Content-Length of the
+// request exceeds n bytes.
+func MaxContentLength(n int64) func(req *http.Request) error {
+	return func(req *http.Request) error {
+		if req.ContentLength > n {
+			return ErrBodyTooLarge
+		}
+		return nil
+	}
+}
+
+// LongPoll calls wait with a context that is done when the timeout
+// elapses or the request is cancelled, whichever happens first. The
+// wait function must return promptly once the context is done. If the
+// timeout elapses first, LongPoll returns a nil result and nil error so
+// the handler may reply with http.StatusNoContent.
+func LongPoll(req *http.Request, timeout time.Duration, wait func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+	v, err := wait(ctx)
+	if err != nil && ctx.Err() == context.DeadlineExceeded && req.Context().Err() == nil {
+		return nil, nil
+	}
+	return v, err
+}
+
 // Redirect replies to the request with a redirect to path.
 // This is the equivalent to http.Redirect and is here for consistency.
 func Redirect(w http.ResponseWriter, req *http.Request, path string, code int) error {
@@ -38,21 +242,145 @@ func RedirectTo(w http.ResponseWriter, req *http.Request, format string, args ..
 	return Redirect(w, req, fmt.Sprintf(format, args...), http.StatusSeeOther)
 }
 
-// RemoteAddr returns a best guess remote address.
+// RedirectWithQuery replies to the request with a http.StatusSeeOther
+// redirect to path, copying the named query parameters of the request
+// on to the target. A name ending in an asterisk, such as "utm_*",
+// matches every parameter with that prefix. Parameters already present
+// in the target are left as is.
+func RedirectWithQuery(w http.ResponseWriter, req *http.Request, path string, keep ...string) error {
+	u, err := url.Parse(path)
+	if err != nil {
+		return err
+	}
+	target := u.Query()
+	added := false
+	for k, v := range req.URL.Query() {
+		if _, ok := target[k]; ok || !keepParam(k, keep) {
+			continue
+		}
+		target[k] = v
+		added = true
+	}
+	if added {
+		u.RawQuery = target.Encode()
+	}
+	return Redirect(w, req, u.String(), http.StatusSeeOther)
+}
+
+// keepParam reports whether the query parameter name matches keep.
+func keepParam(name string, keep []string) bool {
+	for _, k := range keep {
+		prefix, ok := strings.CutSuffix(k, "*")
+		if ok && strings.HasPrefix(name, prefix) || name == k {
+			return true
+		}
+	}
+	return false
+}
+
+// ForwardedHeaders is the list of request headers consulted by RemoteAddr
+// for the client address, in priority order. Set it to match the headers
+// set by the proxies in front of the application, or to nil to always use
+// the address of the connection.
+var ForwardedHeaders = []string{"X-Real-IP", "X-Forwarded-For"}
+
+// RemoteAddr returns a best guess remote address. The first of the
+// ForwardedHeaders present on the request is used, taking the leftmost
+// address of a comma separated list such as X-Forwarded-For. Otherwise
+// the host of the connection remote address is returned.
+//
+// RemoteAddr trusts the forwarding headers of every client, which may
+// be spoofed when the application is directly internet facing. Use
+// RemoteAddrFrom to only trust the headers set by known proxies.
 func RemoteAddr(req *http.Request) string {
-	addr := req.Header.Get("X-Real-IP")
-	if len(addr) == 0 {
-		addr = req.Header.Get("X-Forwarded-For")
-		if addr == "" {
-			addr = req.RemoteAddr
-			host, _, err := net.SplitHostPort(addr)
-			if err != nil {
-				return addr
+	return RemoteAddrFrom(req, trustAll)
+}
+
+// trustAll is the trusted networks of RemoteAddr.
+var trustAll = []*net.IPNet{
+	{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)},
+	{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)},
+}
+
+// RemoteAddrFrom returns the remote address of the client, honoring the
+// ForwardedHeaders only if the connection remote address falls within one
+// of the trusted networks. The addresses of a comma separated list such as
+// X-Forwarded-For are walked from right to left, skipping trusted proxies,
+// and the first untrusted address is returned. If every address is trusted,
+// the leftmost address is returned. Otherwise the host of the connection
+// remote address is returned.
+func RemoteAddrFrom(req *http.Request, trusted []*net.IPNet) string {
+	peer := req.RemoteAddr
+	host, _, err := net.SplitHostPort(peer)
+	if err == nil {
+		peer = host
+	}
+	if !isTrusted(peer, trusted) {
+		return peer
+	}
+	for _, name := range ForwardedHeaders {
+		var addrs []string
+		for _, v := range req.Header.Values(name) {
+			for _, addr := range strings.Split(v, ",") {
+				addr = strings.TrimSpace(addr)
+				if addr != "" {
+					addrs = append(addrs, addr)
+				}
+			}
+		}
+		if len(addrs) == 0 {
+			continue
+		}
+		for i := len(addrs) - 1; i > 0; i-- {
+			if !isTrusted(addrs[i], trusted) {
+				return addrs[i]
 			}
-			return host
 		}
+		return addrs[0]
 	}
-	return addr
+	return peer
+}
+
+// isTrusted reports whether the address, with an optional
+// port, falls within one of the trusted networks.
+func isTrusted(addr string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return false
+		}
+		ip = net.ParseIP(host)
+		if ip == nil {
+			return false
+		}
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestKey returns a deterministic fingerprint of the request for
+// use as a cache key. The key incorporates the method, path, query and
+// the values of the named varyHeaders. Query parameters and headers are
+// sorted by name so that their order does not change the key.
+func RequestKey(req *http.Request, varyHeaders ...string) string {
+	names := make([]string, len(varyHeaders))
+	for i, name := range varyHeaders {
+		names[i] = http.CanonicalHeaderKey(name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	io.WriteString(h, req.Method+"\n")
+	io.WriteString(h, req.URL.EscapedPath()+"\n")
+	io.WriteString(h, req.URL.Query().Encode()+"\n")
+	for _, name := range names {
+		io.WriteString(h, name+":"+strings.Join(req.Header.Values(name), ",")+"\n")
+	}
+	return hex.EncodeToString(h.Sum(nil))
 }
 
 // SetCookie adds a Set-Cookie header to the provided
@@ -67,9 +395,50 @@ func SetCookie(w http.ResponseWriter, cookie *http.Cookie) {
 	http.SetCookie(w, cookie)
 }
 
+// Attachment sets the response headers to download the content written
+// to the returned writer as a file with the suggested filename. Non-ASCII
+// filenames are encoded as described by RFC 5987. If contentType is empty,
+// the Content-Type header is left unset.
+func Attachment(w http.ResponseWriter, filename, contentType string) io.Writer {
+	return disposition(w, "attachment", filename, contentType)
+}
+
+// Inline sets the response headers to display the content written to the
+// returned writer in the browser, such as a PDF or image preview, with a
+// suggested filename for when it is saved. Non-ASCII filenames are encoded
+// as described by RFC 5987. If contentType is empty, the Content-Type
+// header is left unset.
+func Inline(w http.ResponseWriter, filename, contentType string) io.Writer {
+	return disposition(w, "inline", filename, contentType)
+}
+
+// disposition sets the Content-Disposition and Content-Type headers.
+func disposition(w http.ResponseWriter, typ, filename, contentType string) io.Writer {
+	v := typ
+	if filename != "" {
+		v = mime.FormatMediaType(typ, map[string]string{"filename": filename})
+	}
+	w.Header().Set("Content-Disposition", v)
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	return w
+}
+
 // ServeFile replies to the request with the contents of the named file.
 // This is the equivalent to http.ServeFile and is here for consistency.
 func ServeFile(w http.ResponseWriter, req *http.Request, name string) error {
 	http.ServeFile(w, req, name)
 	return nil
 }
+
+// ServeContent replies to the request using the content in the provided
+// io.ReadSeeker, handling Range requests and conditional requests.
+// An If-Range precondition is evaluated against the ETag response header,
+// if set, or modtime. When it matches the requested range is served with
+// http.StatusPartialContent, otherwise the full content is served.
+// This is the equivalent to http.ServeContent and is here for consistency.
+func ServeContent(w http.ResponseWriter, req *http.Request, name string, modtime time.Time, content io.ReadSeeker) error {
+	http.ServeContent(w, req, name, modtime, content)
+	return nil
+}
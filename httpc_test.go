@@ -0,0 +1,500 @@
+package httpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPutResult(t *testing.T) {
+	tests := map[string]struct {
+		method   string
+		created  bool
+		view     Viewable
+		code     int
+		location string
+		body     string
+	}{
+		"created":          {http.MethodPut, true, map[string]int{"id": 1}, http.StatusCreated, "/users/1", `{"id":1}`},
+		"replaced":         {http.MethodPut, false, map[string]int{"id": 1}, http.StatusOK, "", `{"id":1}`},
+		"created no view":  {http.MethodPut, true, nil, http.StatusCreated, "/users/1", ""},
+		"replaced no view": {http.MethodPut, false, nil, http.StatusNoContent, "", ""},
+		"head":             {http.MethodHead, true, map[string]int{"id": 1}, http.StatusCreated, "/users/1", ""},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/users/1", nil)
+		w := httptest.NewRecorder()
+		err := PutResult(w, req, tt.created, tt.view)
+		if err != nil {
+			t.Errorf("TestPutResult %s: %v", name, err)
+			continue
+		}
+		if w.Code != tt.code {
+			t.Errorf("TestPutResult %s: status %d, expected %d", name, w.Code, tt.code)
+		}
+		if v := w.Header().Get("Location"); v != tt.location {
+			t.Errorf("TestPutResult %s: Location %q, expected %q", name, v, tt.location)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("TestPutResult %s: body %q, expected %q", name, w.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestNoStore(t *testing.T) {
+	w := httptest.NewRecorder()
+	NoStore(w)
+	tests := map[string]string{
+		"Cache-Control": "no-store, no-cache, must-revalidate",
+		"Pragma":        "no-cache",
+		"Expires":       "0",
+	}
+	for name, want := range tests {
+		have := w.Header().Get(name)
+		if have != want {
+			t.Errorf("TestNoStore %s: %q, expected %q", name, have, want)
+		}
+	}
+}
+
+func TestPaymentRequired(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := PaymentRequired(w)
+	if err != nil {
+		t.Fatalf("TestPaymentRequired: %v", err)
+	}
+	if w.Code != http.StatusPaymentRequired {
+		t.Errorf("TestPaymentRequired: status %d", w.Code)
+	}
+	if strings.TrimSpace(w.Body.String()) != "Payment Required" {
+		t.Errorf("TestPaymentRequired: body %q", w.Body.String())
+	}
+}
+
+func TestUnavailableForLegalReasons(t *testing.T) {
+	tests := map[string]struct {
+		blockedBy string
+		link      string
+	}{
+		"blocked by": {"https://example.com/legal", `<https://example.com/legal>; rel="blocked-by"`},
+		"no link":    {"", ""},
+	}
+	for name, tt := range tests {
+		w := httptest.NewRecorder()
+		err := UnavailableForLegalReasons(w, tt.blockedBy)
+		if err != nil {
+			t.Fatalf("TestUnavailableForLegalReasons %s: %v", name, err)
+		}
+		if w.Code != http.StatusUnavailableForLegalReasons {
+			t.Errorf("TestUnavailableForLegalReasons %s: status %d", name, w.Code)
+		}
+		link := w.Header().Get("Link")
+		if link != tt.link {
+			t.Errorf("TestUnavailableForLegalReasons %s: Link %q, expected %q", name, link, tt.link)
+		}
+		if strings.TrimSpace(w.Body.String()) != "Unavailable For Legal Reasons" {
+			t.Errorf("TestUnavailableForLegalReasons %s: body %q", name, w.Body.String())
+		}
+	}
+}
+
+func TestDisposition(t *testing.T) {
+	tests := map[string]struct {
+		fn       func(http.ResponseWriter, string, string) io.Writer
+		filename string
+		want     string
+	}{
+		"attachment":       {Attachment, "report.csv", `attachment; filename=report.csv`},
+		"inline":           {Inline, "report.pdf", `inline; filename=report.pdf`},
+		"inline quoted":    {Inline, "my report.pdf", `inline; filename="my report.pdf"`},
+		"inline non-ascii": {Inline, "résumé.pdf", `inline; filename*=utf-8''r%C3%A9sum%C3%A9.pdf`},
+		"inline no name":   {Inline, "", `inline`},
+	}
+	for name, tt := range tests {
+		w := httptest.NewRecorder()
+		io.WriteString(tt.fn(w, tt.filename, "application/pdf"), "%PDF")
+		have := w.Header().Get("Content-Disposition")
+		if have != tt.want {
+			t.Errorf("TestDisposition %s: %q, expected %q", name, have, tt.want)
+		}
+		if w.Header().Get("Content-Type") != "application/pdf" {
+			t.Errorf("TestDisposition %s: Content-Type %q", name, w.Header().Get("Content-Type"))
+		}
+		if w.Body.String() != "%PDF" {
+			t.Errorf("TestDisposition %s: body %q", name, w.Body.String())
+		}
+	}
+}
+
+func TestFullURL(t *testing.T) {
+	tests := map[string]struct {
+		target string
+		tls    bool
+		header http.Header
+		want   string
+	}{
+		"plain":           {"http://example.com/a/b?c=d", false, http.Header{}, "http://example.com/a/b?c=d"},
+		"tls":             {"https://example.com/a", true, http.Header{}, "https://example.com/a"},
+		"escaped":         {"http://example.com/a%20b/c%2Fd?q=x%20y", false, http.Header{}, "http://example.com/a%20b/c%2Fd?q=x%20y"},
+		"forwarded":       {"http://internal:8080/a?b=c", false, http.Header{"X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"example.com"}}, "https://example.com/a?b=c"},
+		"forwarded chain": {"http://internal:8080/", false, http.Header{"X-Forwarded-Proto": {"https, http"}, "X-Forwarded-Host": {"example.com, proxy"}}, "https://example.com/"},
+		"invalid proto":   {"http://example.com/", false, http.Header{"X-Forwarded-Proto": {"javascript"}}, "http://example.com/"},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		if !tt.tls {
+			req.TLS = nil
+		}
+		req.Header = tt.header
+		u := FullURL(req)
+		if u != tt.want {
+			t.Errorf("TestFullURL %s: %q, expected %q", name, u, tt.want)
+		}
+	}
+}
+
+func TestFullURLFrom(t *testing.T) {
+	_, trusted, _ := net.ParseCIDR("10.0.0.0/8")
+	header := http.Header{"X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"example.com"}}
+	tests := map[string]struct {
+		remoteAddr string
+		want       string
+	}{
+		"trusted":   {"10.0.0.1:1234", "https://example.com/a?b=c"},
+		"untrusted": {"192.0.2.1:1234", "http://internal:8080/a?b=c"},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://internal:8080/a?b=c", nil)
+		req.RemoteAddr = tt.remoteAddr
+		req.Header = header
+		u := FullURLFrom(req, []*net.IPNet{trusted})
+		if u != tt.want {
+			t.Errorf("TestFullURLFrom %s: %q, expected %q", name, u, tt.want)
+		}
+	}
+}
+
+func TestHasBody(t *testing.T) {
+	tests := map[string]struct {
+		body io.Reader
+		want bool
+	}{
+		"nil":     {nil, false},
+		"no body": {http.NoBody, false},
+		"known":   {strings.NewReader("foo"), true},
+		"unknown": {io.MultiReader(strings.NewReader("foo")), true},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/", tt.body)
+		if tt.body == nil {
+			req.Body = nil
+		}
+		if HasBody(req) != tt.want {
+			t.Errorf("TestHasBody %s: expected %t", name, tt.want)
+		}
+		if tt.want {
+			b, _ := io.ReadAll(req.Body)
+			if string(b) != "foo" {
+				t.Errorf("TestHasBody %s: body consumed", name)
+			}
+		}
+	}
+}
+
+func TestContinue(t *testing.T) {
+	m := NewMux()
+	m.Post("/upload", func(w http.ResponseWriter, req *http.Request) error {
+		err := Continue(w, req, MaxContentLength(8))
+		if err != nil {
+			return err
+		}
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		return RenderPlain(w, string(b), http.StatusOK)
+	})
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+	client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: 5 * time.Second}}
+	tests := map[string]struct {
+		body string
+		code int
+		sent bool
+	}{
+		"accepted": {"hello", http.StatusOK, true},
+		"rejected": {"hello, world", http.StatusRequestEntityTooLarge, false},
+	}
+	for name, tt := range tests {
+		body := &testSentReader{Reader: strings.NewReader(tt.body)}
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/upload", body)
+		if err != nil {
+			t.Fatalf("TestContinue %s: %v", name, err)
+		}
+		req.ContentLength = int64(len(tt.body))
+		req.Header.Set("Expect", "100-continue")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("TestContinue %s: %v", name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.code {
+			t.Errorf("TestContinue %s: status %d, expected %d", name, resp.StatusCode, tt.code)
+		}
+		if body.sent.Load() != tt.sent {
+			t.Errorf("TestContinue %s: body sent %t, expected %t", name, body.sent.Load(), tt.sent)
+		}
+	}
+}
+
+type testSentReader struct {
+	io.Reader
+	sent atomic.Bool
+}
+
+func (r *testSentReader) Read(b []byte) (int, error) {
+	r.sent.Store(true)
+	return r.Reader.Read(b)
+}
+
+func TestLongPoll(t *testing.T) {
+	events := make(chan interface{}, 1)
+	wait := func(ctx context.Context) (interface{}, error) {
+		select {
+		case v := <-events:
+			return v, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "/poll", nil)
+	events <- "event"
+	v, err := LongPoll(req, time.Second, wait)
+	if err != nil || v != "event" {
+		t.Errorf("TestLongPoll data: (%v, %v), expected (event, nil)", v, err)
+	}
+	v, err = LongPoll(req, 10*time.Millisecond, wait)
+	if err != nil || v != nil {
+		t.Errorf("TestLongPoll timeout: (%v, %v), expected (nil, nil)", v, err)
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	cancel()
+	v, err = LongPoll(req.WithContext(ctx), time.Second, wait)
+	if err != context.Canceled || v != nil {
+		t.Errorf("TestLongPoll cancelled: (%v, %v), expected (nil, %v)", v, err, context.Canceled)
+	}
+}
+
+func TestRemoteAddr(t *testing.T) {
+	defer func(v []string) { ForwardedHeaders = v }(ForwardedHeaders)
+	tests := map[string]struct {
+		headers []string
+		header  http.Header
+		want    string
+	}{
+		"none":              {[]string{"X-Real-IP", "X-Forwarded-For"}, http.Header{}, "192.0.2.1"},
+		"real ip":           {[]string{"X-Real-IP", "X-Forwarded-For"}, http.Header{"X-Real-Ip": {"198.51.100.1"}}, "198.51.100.1"},
+		"forwarded for":     {[]string{"X-Real-IP", "X-Forwarded-For"}, http.Header{"X-Forwarded-For": {"198.51.100.2"}}, "198.51.100.2"},
+		"forwarded chain":   {[]string{"X-Real-IP", "X-Forwarded-For"}, http.Header{"X-Forwarded-For": {"198.51.100.2, 203.0.113.1"}}, "198.51.100.2"},
+		"priority":          {[]string{"X-Real-IP", "X-Forwarded-For"}, http.Header{"X-Real-Ip": {"198.51.100.1"}, "X-Forwarded-For": {"198.51.100.2"}}, "198.51.100.1"},
+		"priority reversed": {[]string{"X-Forwarded-For", "X-Real-IP"}, http.Header{"X-Real-Ip": {"198.51.100.1"}, "X-Forwarded-For": {"198.51.100.2"}}, "198.51.100.2"},
+		"untrusted header":  {[]string{"X-Forwarded-For"}, http.Header{"X-Real-Ip": {"198.51.100.1"}}, "192.0.2.1"},
+		"custom header":     {[]string{"CF-Connecting-IP"}, http.Header{"Cf-Connecting-Ip": {"198.51.100.3"}}, "198.51.100.3"},
+		"disabled":          {nil, http.Header{"X-Real-Ip": {"198.51.100.1"}}, "192.0.2.1"},
+	}
+	for name, tt := range tests {
+		ForwardedHeaders = tt.headers
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header = tt.header
+		addr := RemoteAddr(req)
+		if addr != tt.want {
+			t.Errorf("TestRemoteAddr %s: %q, expected %q", name, addr, tt.want)
+		}
+	}
+}
+
+func TestRedirectWithQuery(t *testing.T) {
+	tests := map[string]struct {
+		url  string
+		path string
+		keep []string
+		want string
+	}{
+		"none":      {"/?next=/a&page=2", "/login", nil, "/login"},
+		"keep":      {"/?next=/a&page=2", "/login", []string{"next"}, "/login?next=%2Fa"},
+		"absent":    {"/?page=2", "/login", []string{"next"}, "/login"},
+		"repeated":  {"/?tag=a&tag=b", "/search", []string{"tag"}, "/search?tag=a&tag=b"},
+		"prefix":    {"/?utm_source=x&utm_medium=y&ref=z", "/", []string{"utm_*"}, "/?utm_medium=y&utm_source=x"},
+		"present":   {"/?next=/a&lang=en", "/login?next=/b", []string{"next", "lang"}, "/login?lang=en&next=%2Fb"},
+		"unchanged": {"/?next=/a", "/login?next=/b", []string{"next"}, "/login?next=/b"},
+		"absolute":  {"/?next=/a", "https://example.com/login", []string{"next"}, "https://example.com/login?next=%2Fa"},
+	}
+	for name, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		err := RedirectWithQuery(w, req, tt.path, tt.keep...)
+		if err != nil {
+			t.Fatalf("TestRedirectWithQuery %s: %v", name, err)
+		}
+		if w.Code != http.StatusSeeOther {
+			t.Errorf("TestRedirectWithQuery %s: status %d, expected %d", name, w.Code, http.StatusSeeOther)
+		}
+		location := w.Header().Get("Location")
+		if location != tt.want {
+			t.Errorf("TestRedirectWithQuery %s: location %q, expected %q", name, location, tt.want)
+		}
+	}
+}
+
+func TestRemoteAddrFrom(t *testing.T) {
+	var trusted []*net.IPNet
+	for _, cidr := range []string{"10.0.0.0/8", "fd00::/8"} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trusted = append(trusted, n)
+	}
+	tests := map[string]struct {
+		remoteAddr string
+		header     http.Header
+		want       string
+	}{
+		"untrusted peer":      {"192.0.2.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "192.0.2.1"},
+		"untrusted real ip":   {"192.0.2.1:1234", http.Header{"X-Real-Ip": {"198.51.100.1"}}, "192.0.2.1"},
+		"trusted peer":        {"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.1"},
+		"trusted real ip":     {"10.0.0.1:1234", http.Header{"X-Real-Ip": {"198.51.100.1"}}, "198.51.100.1"},
+		"trusted no header":   {"10.0.0.1:1234", http.Header{}, "10.0.0.1"},
+		"multi-hop":           {"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"203.0.113.9, 198.51.100.1, 10.0.0.2"}}, "198.51.100.1"},
+		"multi-hop spoofed":   {"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"10.0.0.9, 198.51.100.1"}}, "198.51.100.1"},
+		"multi-hop lines":     {"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"203.0.113.9", "198.51.100.1, 10.0.0.2"}}, "198.51.100.1"},
+		"all trusted":         {"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3"},
+		"ipv6 untrusted peer": {"[2001:db8::1]:1234", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "2001:db8::1"},
+		"ipv6 trusted peer":   {"[fd00::1]:1234", http.Header{"X-Forwarded-For": {"2001:db8::2, fd00::2"}}, "2001:db8::2"},
+		"ipv6 with port":      {"[fd00::1]:1234", http.Header{"X-Forwarded-For": {"2001:db8::2, [fd00::2]:80"}}, "2001:db8::2"},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		req.Header = tt.header
+		addr := RemoteAddrFrom(req, trusted)
+		if addr != tt.want {
+			t.Errorf("TestRemoteAddrFrom %s: %q, expected %q", name, addr, tt.want)
+		}
+	}
+}
+
+func TestRequestKey(t *testing.T) {
+	key := func(method, target string, header http.Header, vary ...string) string {
+		req := httptest.NewRequest(method, target, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		return RequestKey(req, vary...)
+	}
+	base := key(http.MethodGet, "/items?a=1&b=2&c=3", http.Header{"Accept": {"application/json"}}, "Accept")
+	tests := map[string]struct {
+		key  string
+		same bool
+	}{
+		"identical":        {key(http.MethodGet, "/items?a=1&b=2&c=3", http.Header{"Accept": {"application/json"}}, "Accept"), true},
+		"query reordered":  {key(http.MethodGet, "/items?c=3&a=1&b=2", http.Header{"Accept": {"application/json"}}, "Accept"), true},
+		"header case":      {key(http.MethodGet, "/items?b=2&a=1&c=3", http.Header{"Accept": {"application/json"}}, "accept"), true},
+		"unvaried header":  {key(http.MethodGet, "/items?a=1&b=2&c=3", http.Header{"Accept": {"application/json"}, "X-Foo": {"bar"}}, "Accept"), true},
+		"method":           {key(http.MethodHead, "/items?a=1&b=2&c=3", http.Header{"Accept": {"application/json"}}, "Accept"), false},
+		"path":             {key(http.MethodGet, "/other?a=1&b=2&c=3", http.Header{"Accept": {"application/json"}}, "Accept"), false},
+		"query value":      {key(http.MethodGet, "/items?a=1&b=2&c=4", http.Header{"Accept": {"application/json"}}, "Accept"), false},
+		"header value":     {key(http.MethodGet, "/items?a=1&b=2&c=3", http.Header{"Accept": {"text/html"}}, "Accept"), false},
+		"vary differently": {key(http.MethodGet, "/items?a=1&b=2&c=3", http.Header{"Accept": {"application/json"}}), false},
+	}
+	for name, tt := range tests {
+		if (tt.key == base) != tt.same {
+			t.Errorf("TestRequestKey %s: same %t, expected %t", name, tt.key == base, tt.same)
+		}
+	}
+}
+
+func TestServeContentIfRange(t *testing.T) {
+	modtime := time.Date(2016, 12, 26, 0, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		etag    string
+		ifRange string
+		code    int
+		body    string
+	}{
+		"no precondition": {`"v1"`, "", http.StatusPartialContent, "0123"},
+		"etag match":      {`"v1"`, `"v1"`, http.StatusPartialContent, "0123"},
+		"etag mismatch":   {`"v1"`, `"v2"`, http.StatusOK, "0123456789"},
+		"weak etag":       {`W/"v1"`, `W/"v1"`, http.StatusOK, "0123456789"},
+		"date match":      {"", modtime.Format(http.TimeFormat), http.StatusPartialContent, "0123"},
+		"date mismatch":   {"", modtime.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK, "0123456789"},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/file.txt", nil)
+		req.Header.Set("Range", "bytes=0-3")
+		if tt.ifRange != "" {
+			req.Header.Set("If-Range", tt.ifRange)
+		}
+		w := httptest.NewRecorder()
+		if tt.etag != "" {
+			w.Header().Set("ETag", tt.etag)
+		}
+		err := ServeContent(w, req, "file.txt", modtime, strings.NewReader("0123456789"))
+		if err != nil {
+			t.Errorf("TestServeContentIfRange %s: %v", name, err)
+			continue
+		}
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("TestServeContentIfRange %s: (%d, %q), expected (%d, %q)", name, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+	}
+}
+
+func TestAbortRequest(t *testing.T) {
+	tests := map[string]struct {
+		accept   string
+		jsonOnly bool
+		media    string
+		body     string
+	}{
+		"none":     {"", false, "text/plain", "Not Found\n"},
+		"plain":    {"text/plain", false, "text/plain", "Not Found\n"},
+		"wildcard": {"*/*", false, "text/plain", "Not Found\n"},
+		"json":     {"application/json", false, "application/json", `{"error":"Not Found","status":404}`},
+		"html":     {"text/html,application/xhtml+xml,*/*;q=0.8", false, "text/html", "<!DOCTYPE html>\n<title>404 Not Found</title>\n<h1>Not Found</h1>\n"},
+		"quality":  {"text/html;q=0.5, application/json", false, "application/json", `{"error":"Not Found","status":404}`},
+		"fallback": {"image/png", false, "text/plain", "Not Found\n"},
+		"jsonOnly": {"text/html", true, "application/json", `{"error":"Not Found","status":404}`},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		if tt.jsonOnly {
+			req = WithValue(req, keyJSONOnly, true)
+		}
+		w := httptest.NewRecorder()
+		err := AbortRequest(w, req, http.StatusNotFound)
+		if err != nil {
+			t.Errorf("TestAbortRequest %s: %v", name, err)
+			continue
+		}
+		if w.Code != http.StatusNotFound {
+			t.Errorf("TestAbortRequest %s: status %d, expected %d", name, w.Code, http.StatusNotFound)
+		}
+		if v := w.Header().Get("Content-Type"); !strings.HasPrefix(v, tt.media) {
+			t.Errorf("TestAbortRequest %s: content type %q, expected %q", name, v, tt.media)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("TestAbortRequest %s: body %q, expected %q", name, w.Body.String(), tt.body)
+		}
+	}
+}
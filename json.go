@@ -0,0 +1,184 @@
+package httpc
+
+import (
+	"encoding"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Marshal returns the JSON encoding of v for MarshalJSON and the
+// functions rendering JSON, such as RenderJSON. It may be replaced with
+// a compatible encoder during program initialization for performance.
+var Marshal func(v interface{}) ([]byte, error) = stdMarshal
+
+// stdMarshal is the default Marshal using encoding/json.
+func stdMarshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// stdMarshalPC identifies stdMarshal so that a replaced Marshal
+// is detected without tracking assignments to the variable.
+var stdMarshalPC = reflect.ValueOf(stdMarshal).Pointer()
+
+// isStdMarshal reports whether Marshal is the default stdMarshal.
+func isStdMarshal() bool {
+	return reflect.ValueOf(Marshal).Pointer() == stdMarshalPC
+}
+
+// A Decoder reads and decodes JSON values from an input stream.
+// It is satisfied by *json.Decoder and the decoders of compatible
+// packages.
+type Decoder interface {
+	// Decode reads the next JSON value from its input and stores it in
+	// the value pointed to by v. It returns io.EOF at the end of input.
+	Decode(v interface{}) error
+
+	// DisallowUnknownFields causes Decode to return an error when the
+	// destination is a struct and the input contains object keys which
+	// do not match any non-ignored, exported fields in the destination.
+	DisallowUnknownFields()
+}
+
+// An UnknownFieldDecoder is a Decoder that identifies the errors returned
+// by Decode for unknown fields, so that they are reported with
+// ErrUnknownField if DisallowUnknownFields is enabled.
+type UnknownFieldDecoder interface {
+	Decoder
+
+	// UnknownField returns the name of the unknown field
+	// reported by err, if err reports an unknown field.
+	UnknownField(err error) (name string, ok bool)
+}
+
+// NewDecoder returns a Decoder reading from r for ValidateJSON and the
+// functions decoding JSON request bodies. It may be replaced with a
+// compatible decoder during program initialization for performance.
+// Unknown fields are reported with ErrUnknownField only if the decoder
+// implements UnknownFieldDecoder, as the default decoder does.
+var NewDecoder func(r io.Reader) Decoder = newDecoder
+
+// newDecoder returns a json.Decoder reading from r.
+func newDecoder(r io.Reader) Decoder {
+	return stdDecoder{json.NewDecoder(r)}
+}
+
+// stdDecoder is the default Decoder using encoding/json.
+type stdDecoder struct {
+	*json.Decoder
+}
+
+// UnknownField implements the UnknownFieldDecoder interface. The
+// errors of encoding/json for unknown fields have no type of their
+// own and are identified by their message on a best-effort basis.
+func (d stdDecoder) UnknownField(err error) (string, bool) {
+	return strings.CutPrefix(err.Error(), "json: unknown field ")
+}
+
+// RenderTime, if non-nil, replaces the default RFC 3339 JSON encoding
+// of Time values, such as with Unix milliseconds, so that the format is
+// consistent across all endpoints. The returned value is marshalled in
+// place of the time. It must be set during program initialization.
+var RenderTime func(t time.Time) interface{}
+
+// Time is a time.Time marshalled as JSON with RenderTime. Views declare
+// fields of type Time, rather than time.Time, to render them in the
+// configured format.
+type Time struct {
+	time.Time
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (t Time) MarshalJSON() ([]byte, error) {
+	if RenderTime == nil {
+		return t.Time.MarshalJSON()
+	}
+	return Marshal(RenderTime(t.Time))
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	unmarshalerType   = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// isMarshaler reports whether t or a pointer to t implements
+// json.Marshaler or encoding.TextMarshaler.
+func isMarshaler(t reflect.Type) bool {
+	return t.Implements(marshalerType) || t.Implements(textMarshalerType) ||
+		reflect.PtrTo(t).Implements(marshalerType) || reflect.PtrTo(t).Implements(textMarshalerType)
+}
+
+// maxEmptyCollectionsDepth bounds the recursion of emptyCollections
+// so that cyclic values are left for encoding/json to report.
+const maxEmptyCollectionsDepth = 1000
+
+// emptyCollections returns a copy of v with nil slices and maps
+// replaced by empty ones. The value v is not modified.
+func emptyCollections(v reflect.Value, depth int) reflect.Value {
+	if !v.IsValid() || depth > maxEmptyCollectionsDepth {
+		return v
+	}
+	t := v.Type()
+	if isMarshaler(t) {
+		return v
+	}
+	depth++
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		r := reflect.New(t).Elem()
+		r.Set(emptyCollections(v.Elem(), depth))
+		return r
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		p := reflect.New(t.Elem())
+		p.Elem().Set(emptyCollections(v.Elem(), depth))
+		return p
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return v
+		}
+		if v.IsNil() {
+			return reflect.MakeSlice(t, 0, 0)
+		}
+		s := reflect.MakeSlice(t, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			s.Index(i).Set(emptyCollections(v.Index(i), depth))
+		}
+		return s
+	case reflect.Array:
+		a := reflect.New(t).Elem()
+		for i := 0; i < v.Len(); i++ {
+			a.Index(i).Set(emptyCollections(v.Index(i), depth))
+		}
+		return a
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.MakeMap(t)
+		}
+		m := reflect.MakeMapWithSize(t, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m.SetMapIndex(iter.Key(), emptyCollections(iter.Value(), depth))
+		}
+		return m
+	case reflect.Struct:
+		s := reflect.New(t).Elem()
+		s.Set(v)
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				continue
+			}
+			s.Field(i).Set(emptyCollections(v.Field(i), depth))
+		}
+		return s
+	}
+	return v
+}
@@ -0,0 +1,50 @@
+package httpc
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// RequestLogger returns middleware that stores a logger derived from
+// logger in the request context with the request method, path, matched
+// pattern, remote address and request ID attached, so that handlers may
+// log correlated records with Logger. If logger is nil, slog.Default is
+// used.
+//
+// The middleware should be registered with Mux.Use so that it runs
+// after routing has been performed and the matched pattern is known.
+func RequestLogger(logger *slog.Logger) func(http.Handler) http.Handler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, req *http.Request) {
+			var matched string
+			p := Pattern(req)
+			if p != nil {
+				matched = p.String()
+			}
+			l := logger.With(
+				slog.String("method", req.Method),
+				slog.String("path", req.URL.Path),
+				slog.String("pattern", matched),
+				slog.String("remote_addr", RemoteAddr(req)),
+				slog.String("request_id", RequestID(req)),
+			)
+			ctx := context.WithValue(req.Context(), keyLogger, l)
+			h.ServeHTTP(w, req.WithContext(ctx))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// Logger returns the request scoped logger stored by RequestLogger,
+// or slog.Default if the middleware did not run.
+func Logger(req *http.Request) *slog.Logger {
+	l, ok := req.Context().Value(keyLogger).(*slog.Logger)
+	if !ok {
+		return slog.Default()
+	}
+	return l
+}
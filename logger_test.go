@@ -0,0 +1,43 @@
+package httpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewMux()
+	m.Use(RequestLogger(slog.New(slog.NewJSONHandler(&buf, nil))))
+	m.Get("/users/:id", func(w http.ResponseWriter, req *http.Request) error {
+		Logger(req).Info("hello")
+		return NoContent(w)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	req.Header.Set("X-Request-ID", "abc123")
+	testServe(m, req)
+	var record struct {
+		Msg       string `json:"msg"`
+		Method    string `json:"method"`
+		Pattern   string `json:"pattern"`
+		RequestID string `json:"request_id"`
+	}
+	err := json.Unmarshal(buf.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("TestRequestLogger: %v", err)
+	}
+	if record.Msg != "hello" || record.Method != http.MethodGet || record.Pattern != "/users/:id" || record.RequestID != "abc123" {
+		t.Errorf("TestRequestLogger: %+v", record)
+	}
+}
+
+func TestLoggerDefault(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if Logger(req) != slog.Default() {
+		t.Errorf("TestLoggerDefault: expected slog.Default")
+	}
+}
@@ -0,0 +1,438 @@
+package httpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// BodyReadTimeout returns middleware that limits the time allowed for
+// reading the request body to the duration d. Clients that fail to send
+// the body in time receive http.StatusRequestTimeout, protecting handlers
+// from slow bodies. Bodies larger than n bytes, or DefaultMaxBodySize if n
+// is not positive, receive http.StatusRequestEntityTooLarge. The response
+// of the handler is discarded in both cases. The body is not buffered.
+//
+// The read deadline is applied with http.ResponseController and is never
+// later than the ReadTimeout of the server. If the handler returns before
+// reading the whole body, the deadline is cleared if the server has no
+// ReadTimeout and is otherwise left in force. If the ResponseWriter does
+// not support read deadlines, the deadline is checked around every read,
+// so a read that is already blocked is only interrupted by the server.
+func BodyReadTimeout(d time.Duration, n int64) func(http.Handler) http.Handler {
+	if n <= 0 {
+		n = DefaultMaxBodySize
+	}
+	return func(h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, req *http.Request) {
+			if !HasBody(req) {
+				h.ServeHTTP(w, req)
+				return
+			}
+			deadline := time.Now().Add(d)
+			srv, _ := req.Context().Value(http.ServerContextKey).(*http.Server)
+			if srv != nil && srv.ReadTimeout > 0 && srv.ReadTimeout < d {
+				deadline = time.Now().Add(srv.ReadTimeout)
+			}
+			body := &deadlineBody{ReadCloser: http.MaxBytesReader(w, req.Body, n), deadline: deadline}
+			// The server clears the read deadline itself once the
+			// body has been read, so it is only restored otherwise.
+			rc := http.NewResponseController(w)
+			err := rc.SetReadDeadline(deadline)
+			body.check = err != nil
+			if err == nil && (srv == nil || srv.ReadTimeout <= 0) {
+				defer func() {
+					if !body.eof {
+						rc.SetReadDeadline(time.Time{})
+					}
+				}()
+			}
+			bw := &bodyWriter{ResponseWriter: w, body: body}
+			req.Body = body
+			h.ServeHTTP(bw, req)
+			if body.code != 0 && !bw.wroteHeader {
+				bw.WriteHeader(body.code)
+			}
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// deadlineBody is a request body for the BodyReadTimeout middleware that
+// records the status code replying to the error of a failed read.
+type deadlineBody struct {
+	io.ReadCloser
+	deadline time.Time
+	check    bool // deadline not set on the connection
+	eof      bool
+	code     int
+}
+
+// Read implements the io.Reader interface.
+func (b *deadlineBody) Read(p []byte) (int, error) {
+	if b.check && time.Now().After(b.deadline) {
+		b.code = http.StatusRequestTimeout
+		return 0, os.ErrDeadlineExceeded
+	}
+	n, err := b.ReadCloser.Read(p)
+	var ne net.Error
+	var mbe *http.MaxBytesError
+	switch {
+	case b.check && time.Now().After(b.deadline):
+		b.code = http.StatusRequestTimeout
+		return n, os.ErrDeadlineExceeded
+	case err == io.EOF:
+		b.eof = true
+	case errors.As(err, &ne) && ne.Timeout():
+		b.code = http.StatusRequestTimeout
+	case errors.As(err, &mbe):
+		b.code = http.StatusRequestEntityTooLarge
+	}
+	return n, err
+}
+
+// bodyWriter is a http.ResponseWriter that replaces the response with
+// the status code of a failed body read for the BodyReadTimeout middleware.
+type bodyWriter struct {
+	http.ResponseWriter
+	body        *deadlineBody
+	wroteHeader bool
+	failed      bool
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+// Informational status codes are written as is.
+func (w *bodyWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	if code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.wroteHeader = true
+	if w.body.code == 0 {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.failed = true
+	w.Header().Del("Content-Length")
+	w.Header().Set("Connection", "close")
+	Abort(w.ResponseWriter, w.body.code)
+}
+
+// Write implements the http.ResponseWriter interface.
+func (w *bodyWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.failed {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying http.ResponseWriter.
+func (w *bodyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// LimitRequestBody returns middleware that limits request bodies to n
+// bytes. Requests declaring a larger Content-Length are rejected with
+// http.StatusRequestEntityTooLarge before the body is read, so clients
+// sending Expect: 100-continue are refused without uploading the body.
+// Bodies of unknown length are limited with http.MaxBytesReader.
+func LimitRequestBody(n int64) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, req *http.Request) {
+			if req.ContentLength > n {
+				w.Header().Set("Connection", "close")
+				Abort(w, http.StatusRequestEntityTooLarge)
+				return
+			}
+			if HasBody(req) {
+				req.Body = http.MaxBytesReader(w, req.Body, n)
+			}
+			h.ServeHTTP(w, req)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// DefaultMaxURLLength is the maximum length in bytes of the request
+// path and query used by LimitURLLength if its limit is not positive.
+const DefaultMaxURLLength = 8 << 10 // 8 KB
+
+// LimitURLLength returns middleware that replies with
+// http.StatusRequestURITooLong to requests whose escaped path or raw
+// query is longer than n bytes. If n is not positive,
+// DefaultMaxURLLength is used.
+func LimitURLLength(n int) func(http.Handler) http.Handler {
+	if n <= 0 {
+		n = DefaultMaxURLLength
+	}
+	return func(h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, req *http.Request) {
+			if len(req.URL.EscapedPath()) > n || len(req.URL.RawQuery) > n {
+				Abort(w, http.StatusRequestURITooLong)
+				return
+			}
+			h.ServeHTTP(w, req)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// RequireAccept returns middleware that replies with
+// http.StatusNotAcceptable unless the Accept header of the request
+// explicitly accepts one of the media types, such as application/json.
+// Media ranges are compared as is, so a missing Accept header or a
+// wildcard such as */* is only accepted if listed in types.
+func RequireAccept(types ...string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(types))
+	for _, t := range types {
+		allowed[strings.ToLower(t)] = true
+	}
+	return func(h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, req *http.Request) {
+			for _, r := range parseAccept(req.Header.Get("Accept")) {
+				if r.q > 0 && allowed[r.typ+"/"+r.subtype] {
+					h.ServeHTTP(w, req)
+					return
+				}
+			}
+			abort(w, req, http.StatusNotAcceptable)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// NoStoreHandler is middleware that calls NoStore for every response,
+// such as for a sub-mux serving a sensitive subtree.
+func NoStoreHandler(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		NoStore(w)
+		h.ServeHTTP(w, req)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// SafeMethods returns middleware that asserts GET and HEAD handlers
+// are free of side effects. When debug is true, a GET or HEAD response
+// that sets a cookie or replies with a status implying a state change,
+// such as http.StatusCreated, is logged and replaced with
+// http.StatusInternalServerError. The middleware is a no-op when debug
+// is false and is intended for development only. Violations are logged
+// with Logger, so the logger may be configured with RequestLogger.
+func SafeMethods(debug bool) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		if !debug {
+			return h
+		}
+		fn := func(w http.ResponseWriter, req *http.Request) {
+			if req.Method != http.MethodGet && req.Method != http.MethodHead {
+				h.ServeHTTP(w, req)
+				return
+			}
+			h.ServeHTTP(&safeWriter{ResponseWriter: w, req: req}, req)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// unsafeStatus is the set of status codes implying a state change.
+var unsafeStatus = map[int]bool{
+	http.StatusCreated:  true,
+	http.StatusAccepted: true,
+}
+
+// safeWriter is a http.ResponseWriter that fails responses
+// with side effects for the SafeMethods middleware.
+type safeWriter struct {
+	http.ResponseWriter
+	req         *http.Request
+	wroteHeader bool
+	failed      bool
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+// Informational status codes are written as is.
+func (w *safeWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	if code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.wroteHeader = true
+	var reason string
+	switch {
+	case unsafeStatus[code]:
+		reason = "replied with " + http.StatusText(code)
+	case len(w.Header()["Set-Cookie"]) > 0:
+		reason = "set a cookie"
+	default:
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.failed = true
+	Logger(w.req).LogAttrs(w.req.Context(), slog.LevelError, "httpc: "+w.req.Method+" handler "+reason,
+		slog.String("method", w.req.Method), slog.String("path", w.req.URL.Path))
+	w.Header().Del("Set-Cookie")
+	RenderPlain(w.ResponseWriter, "httpc: "+w.req.Method+" handler "+reason, http.StatusInternalServerError)
+}
+
+// Unwrap returns the underlying http.ResponseWriter.
+func (w *safeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Write implements the http.ResponseWriter interface.
+func (w *safeWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.failed {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Transform returns middleware that buffers the response body and
+// replaces it with the result of transform, writing it with an updated
+// Content-Length. If transform returns an error the response is replaced
+// with http.StatusInternalServerError. Responses to HEAD requests without
+// a body are sent without a Content-Length, since the length of the
+// transformed body is unknown. Handlers that flush the response, such as
+// streaming handlers, bypass the transformation.
+func Transform(transform func([]byte) ([]byte, error)) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, req *http.Request) {
+			tw := &transformWriter{bufferedWriter: newBufferedWriter(w), w: w}
+			h.ServeHTTP(tw, req)
+			if tw.streaming {
+				return
+			}
+			head := req.Method == http.MethodHead && tw.buf.Len() == 0
+			b, err := transform(tw.buf.Bytes())
+			if err != nil {
+				Abort(w, http.StatusInternalServerError)
+				return
+			}
+			tw.buf.Reset()
+			tw.buf.Write(b)
+			code := tw.status()
+			switch {
+			case code == http.StatusNoContent || code == http.StatusNotModified:
+			case head:
+				tw.header.Del("Content-Length")
+			default:
+				tw.header.Set("Content-Length", strconv.Itoa(len(b)))
+			}
+			tw.commit(w)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// transformWriter is a http.ResponseWriter that buffers the response
+// for the Transform middleware until the handler flushes it.
+type transformWriter struct {
+	*bufferedWriter
+	w         http.ResponseWriter
+	streaming bool
+}
+
+// Header implements the http.ResponseWriter interface.
+func (w *transformWriter) Header() http.Header {
+	if w.streaming {
+		return w.w.Header()
+	}
+	return w.bufferedWriter.Header()
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+func (w *transformWriter) WriteHeader(code int) {
+	if w.streaming {
+		w.w.WriteHeader(code)
+		return
+	}
+	w.bufferedWriter.WriteHeader(code)
+}
+
+// Write implements the http.ResponseWriter interface.
+func (w *transformWriter) Write(b []byte) (int, error) {
+	if w.streaming {
+		return w.w.Write(b)
+	}
+	return w.bufferedWriter.Write(b)
+}
+
+// Flush implements the http.Flusher interface.
+func (w *transformWriter) Flush() {
+	w.FlushError()
+}
+
+// FlushError flushes the response for http.ResponseController. The
+// buffered response is written as is and buffering is bypassed from
+// then on.
+func (w *transformWriter) FlushError() error {
+	if !w.streaming {
+		w.streaming = true
+		err := w.commit(w.w)
+		if err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(w.w).Flush()
+}
+
+// Coalesce returns middleware that coalesces concurrent identical GET and
+// HEAD requests so that the handler runs once and its buffered response is
+// shared among all of the waiting requests. Requests are identical if their
+// RequestKey, including the Authorization and Cookie headers and the
+// varyHeaders, is equal, so that responses are only shared among requests
+// with the same credentials. Other methods are never coalesced. The shared
+// response is computed with the context of the first request without its
+// cancellation, so that a canceled request only stops waiting for it.
+func Coalesce(varyHeaders ...string) func(http.Handler) http.Handler {
+	var g singleflight.Group
+	keyHeaders := append([]string{"Authorization", "Cookie"}, varyHeaders...)
+	return func(h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, req *http.Request) {
+			if req.Method != http.MethodGet && req.Method != http.MethodHead {
+				h.ServeHTTP(w, req)
+				return
+			}
+			opts := renderOptionsOf(w)
+			ch := g.DoChan(RequestKey(req, keyHeaders...), func() (interface{}, error) {
+				bw := &bufferedWriter{w: &renderWriter{opts: opts}, header: make(http.Header)}
+				h.ServeHTTP(bw, req.WithContext(context.WithoutCancel(req.Context())))
+				return bw, nil
+			})
+			var res singleflight.Result
+			select {
+			case res = <-ch:
+			case <-req.Context().Done():
+				return
+			}
+			bw := res.Val.(*bufferedWriter)
+			for k, v := range bw.header {
+				w.Header()[k] = append([]string(nil), v...)
+			}
+			w.WriteHeader(bw.status())
+			w.Write(bw.buf.Bytes())
+		}
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,562 @@
+package httpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBodyReadTimeout(t *testing.T) {
+	h := func(w http.ResponseWriter, req *http.Request) {
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			Abort(w, http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, string(b))
+	}
+	srv := httptest.NewServer(BodyReadTimeout(50*time.Millisecond, 0)(http.HandlerFunc(h)))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL, "text/plain", strings.NewReader("fast"))
+	if err != nil {
+		t.Fatalf("TestBodyReadTimeout: %v", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(b) != "fast" {
+		t.Errorf("TestBodyReadTimeout fast: status %d body %q", resp.StatusCode, b)
+	}
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go func() {
+		io.WriteString(pw, "slow")
+	}()
+	resp, err = http.Post(srv.URL, "text/plain", pr)
+	if err != nil {
+		t.Fatalf("TestBodyReadTimeout: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("TestBodyReadTimeout slow: status %d, expected %d", resp.StatusCode, http.StatusRequestTimeout)
+	}
+}
+
+type testSlowReader struct {
+	delay time.Duration
+}
+
+func (r testSlowReader) Read(b []byte) (int, error) {
+	time.Sleep(r.delay)
+	return 0, io.EOF
+}
+
+func TestBodyReadTimeoutLimits(t *testing.T) {
+	h := BodyReadTimeout(20*time.Millisecond, 8)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := io.ReadAll(req.Body)
+		w.Write(b)
+	}))
+	tests := map[string]struct {
+		body io.Reader
+		code int
+		want string
+	}{
+		"under":       {strings.NewReader("0123"), http.StatusOK, "0123"},
+		"over":        {strings.NewReader("0123456789"), http.StatusRequestEntityTooLarge, ""},
+		"unsupported": {testSlowReader{100 * time.Millisecond}, http.StatusRequestTimeout, ""},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/", tt.body)
+		req.ContentLength = -1
+		start := time.Now()
+		w := testServe(h, req)
+		if w.Code != tt.code {
+			t.Errorf("TestBodyReadTimeoutLimits %s: status %d, expected %d", name, w.Code, tt.code)
+		}
+		if tt.want != "" && w.Body.String() != tt.want {
+			t.Errorf("TestBodyReadTimeoutLimits %s: body %q, expected %q", name, w.Body.String(), tt.want)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("TestBodyReadTimeoutLimits %s: took %v", name, elapsed)
+		}
+	}
+}
+
+type testDeadlineWriter struct {
+	*httptest.ResponseRecorder
+	deadlines []time.Time
+}
+
+func (w *testDeadlineWriter) SetReadDeadline(deadline time.Time) error {
+	w.deadlines = append(w.deadlines, deadline)
+	return nil
+}
+
+func TestBodyReadTimeoutRestore(t *testing.T) {
+	tests := map[string]struct {
+		readTimeout time.Duration
+		read        bool
+		deadlines   []time.Duration
+	}{
+		"no server timeout": {0, false, []time.Duration{time.Second, 0}},
+		"read":              {0, true, []time.Duration{time.Second}},
+		"server timeout":    {time.Minute, false, []time.Duration{time.Second}},
+		"shorter server":    {time.Millisecond * 500, false, []time.Duration{time.Millisecond * 500}},
+	}
+	for name, tt := range tests {
+		h := BodyReadTimeout(time.Second, 0)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if tt.read {
+				io.ReadAll(req.Body)
+			}
+		}))
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("body"))
+		ctx := context.WithValue(req.Context(), http.ServerContextKey, &http.Server{ReadTimeout: tt.readTimeout})
+		w := &testDeadlineWriter{ResponseRecorder: httptest.NewRecorder()}
+		start := time.Now()
+		h.ServeHTTP(w, req.WithContext(ctx))
+		if len(w.deadlines) != len(tt.deadlines) {
+			t.Errorf("TestBodyReadTimeoutRestore %s: %d deadlines set, expected %d", name, len(w.deadlines), len(tt.deadlines))
+			continue
+		}
+		near := func(got time.Time, want time.Duration) bool {
+			if want == 0 {
+				return got.IsZero()
+			}
+			d := got.Sub(start)
+			return d >= want-100*time.Millisecond && d <= want+100*time.Millisecond
+		}
+		for i, want := range tt.deadlines {
+			if !near(w.deadlines[i], want) {
+				t.Errorf("TestBodyReadTimeoutRestore %s: deadline %d %v after start, expected %v", name, i, w.deadlines[i].Sub(start), want)
+			}
+		}
+	}
+}
+
+func TestSafeMethods(t *testing.T) {
+	tests := map[string]struct {
+		method string
+		debug  bool
+		cookie bool
+		code   int
+		want   int
+	}{
+		"get ok":         {http.MethodGet, true, false, http.StatusOK, http.StatusOK},
+		"get cookie":     {http.MethodGet, true, true, http.StatusOK, http.StatusInternalServerError},
+		"get created":    {http.MethodGet, true, false, http.StatusCreated, http.StatusInternalServerError},
+		"head created":   {http.MethodHead, true, false, http.StatusCreated, http.StatusInternalServerError},
+		"post cookie":    {http.MethodPost, true, true, http.StatusCreated, http.StatusCreated},
+		"debug disabled": {http.MethodGet, false, true, http.StatusCreated, http.StatusCreated},
+	}
+	for name, tt := range tests {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&buf, nil))
+		h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if tt.cookie {
+				SetCookie(w, &http.Cookie{Name: "session", Value: "1"})
+			}
+			w.WriteHeader(tt.code)
+			w.Write([]byte("body"))
+		})
+		w := testServe(RequestLogger(logger)(SafeMethods(tt.debug)(h)), httptest.NewRequest(tt.method, "/", nil))
+		if w.Code != tt.want {
+			t.Errorf("TestSafeMethods %s: status %d, expected %d", name, w.Code, tt.want)
+		}
+		if logged := strings.Contains(buf.String(), "level=ERROR"); logged != (tt.want != tt.code) {
+			t.Errorf("TestSafeMethods %s: logged %v\n%s", name, logged, buf.String())
+		}
+		if w.Code == http.StatusInternalServerError && w.Header().Get("Set-Cookie") != "" {
+			t.Errorf("TestSafeMethods %s: expected cookie to be removed", name)
+		}
+	}
+}
+
+func TestSafeMethodsInformational(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.WriteHeader(http.StatusCreated)
+	})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := httptest.NewServer(RequestLogger(logger)(SafeMethods(true)(h)))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("TestSafeMethodsInformational: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("TestSafeMethodsInformational: status %d, expected %d", resp.StatusCode, http.StatusInternalServerError)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	upper := Transform(func(b []byte) ([]byte, error) {
+		return bytes.ToUpper(b), nil
+	})
+	tests := map[string]struct {
+		stream bool
+		want   string
+		length string
+	}{
+		"buffered":  {false, "HELLO, WORLD", "12"},
+		"streaming": {true, "hello, world", ""},
+	}
+	for name, tt := range tests {
+		h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Length", "5")
+			io.WriteString(w, "hello, ")
+			if tt.stream {
+				w.Header().Del("Content-Length")
+				w.(http.Flusher).Flush()
+			}
+			io.WriteString(w, "world")
+		})
+		w := testServe(upper(h), httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Body.String() != tt.want {
+			t.Errorf("TestTransform %s: body %q, expected %q", name, w.Body.String(), tt.want)
+		}
+		if v := w.Header().Get("Content-Length"); v != tt.length {
+			t.Errorf("TestTransform %s: Content-Length %q, expected %q", name, v, tt.length)
+		}
+		if v := w.Header().Get("Content-Type"); v != "text/plain" {
+			t.Errorf("TestTransform %s: Content-Type %q", name, v)
+		}
+	}
+}
+
+func TestTransformStream(t *testing.T) {
+	upper := Transform(func(b []byte) ([]byte, error) {
+		return bytes.ToUpper(b), nil
+	})
+	tests := map[string]struct {
+		h    http.HandlerFunc
+		want string
+	}{
+		"sse": {
+			h: func(w http.ResponseWriter, req *http.Request) {
+				events := make(chan Event, 1)
+				events <- Event{Data: "hello"}
+				close(events)
+				err := RenderEventStream(w, req, events)
+				if err != nil {
+					t.Errorf("TestTransformStream sse: %v", err)
+				}
+			},
+			want: "data: hello\n\n",
+		},
+		"json": {
+			h: func(w http.ResponseWriter, req *http.Request) {
+				err := StreamJSON(w, map[string]string{"a": "b"}, http.StatusOK)
+				if err != nil {
+					t.Errorf("TestTransformStream json: %v", err)
+				}
+			},
+			want: "{\"a\":\"b\"}\n",
+		},
+	}
+	for name, tt := range tests {
+		w := &testFlusher{ResponseRecorder: httptest.NewRecorder()}
+		upper(tt.h).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Body.String() != tt.want {
+			t.Errorf("TestTransformStream %s: body %q, expected %q", name, w.Body.String(), tt.want)
+		}
+		if w.flushes == 0 {
+			t.Errorf("TestTransformStream %s: expected flush", name)
+		}
+	}
+}
+
+func TestTransformHead(t *testing.T) {
+	upper := Transform(func(b []byte) ([]byte, error) {
+		return append(bytes.ToUpper(b), '!'), nil
+	})
+	tests := map[string]struct {
+		body   string
+		length string
+	}{
+		"no body": {"", ""},
+		"body":    {"hello", "6"},
+	}
+	for name, tt := range tests {
+		h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Length", "42")
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, tt.body)
+		})
+		w := testServe(upper(h), httptest.NewRequest(http.MethodHead, "/", nil))
+		if v := w.Header().Get("Content-Length"); v != tt.length {
+			t.Errorf("TestTransformHead %s: Content-Length %q, expected %q", name, v, tt.length)
+		}
+	}
+}
+
+type testReadCounter struct {
+	io.Reader
+	reads int
+}
+
+func (r *testReadCounter) Read(b []byte) (int, error) {
+	r.reads++
+	return r.Reader.Read(b)
+}
+
+func (r *testReadCounter) Close() error {
+	return nil
+}
+
+func TestNoStoreHandler(t *testing.T) {
+	m := NewMux()
+	m.Get("/public", testPatternHandler)
+	sub := m.NewSubMux("/account/*")
+	sub.Use(NoStoreHandler)
+	sub.Get("/settings", testPatternHandler)
+	tests := map[string]struct {
+		path string
+		want string
+	}{
+		"public":  {"/public", ""},
+		"account": {"/account/settings", "no-store, no-cache, must-revalidate"},
+	}
+	for name, tt := range tests {
+		w := testServe(m, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		have := w.Header().Get("Cache-Control")
+		if have != tt.want {
+			t.Errorf("TestNoStoreHandler %s: Cache-Control %q, expected %q", name, have, tt.want)
+		}
+	}
+}
+
+func TestLimitURLLength(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		NoContent(w)
+	})
+	tests := map[string]struct {
+		limit int
+		url   string
+		code  int
+	}{
+		"under":         {16, "/users?page=1", http.StatusNoContent},
+		"path at limit": {16, "/" + strings.Repeat("a", 15), http.StatusNoContent},
+		"path over":     {16, "/" + strings.Repeat("a", 16), http.StatusRequestURITooLong},
+		"query over":    {16, "/?q=" + strings.Repeat("a", 15), http.StatusRequestURITooLong},
+		"escaped over":  {16, "/" + strings.Repeat("%20", 6), http.StatusRequestURITooLong},
+		"default under": {0, "/?q=" + strings.Repeat("a", DefaultMaxURLLength-2), http.StatusNoContent},
+		"default over":  {0, "/?q=" + strings.Repeat("a", DefaultMaxURLLength), http.StatusRequestURITooLong},
+	}
+	for name, tt := range tests {
+		w := testServe(LimitURLLength(tt.limit)(h), httptest.NewRequest(http.MethodGet, tt.url, nil))
+		if w.Code != tt.code {
+			t.Errorf("TestLimitURLLength %s: status %d, expected %d", name, w.Code, tt.code)
+		}
+		if tt.code == http.StatusRequestURITooLong && (http.StatusText(tt.code) == "" || w.Body.String() != http.StatusText(tt.code)+"\n") {
+			t.Errorf("TestLimitURLLength %s: body %q", name, w.Body.String())
+		}
+	}
+}
+
+func TestLimitRequestBody(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, err := io.ReadAll(req.Body)
+		if err != nil {
+			Abort(w, http.StatusRequestEntityTooLarge)
+			return
+		}
+		NoContent(w)
+	})
+	tests := map[string]struct {
+		body   string
+		length int64
+		code   int
+		read   bool
+	}{
+		"under":            {"0123", 4, http.StatusNoContent, true},
+		"declared over":    {"0123456789", 10, http.StatusRequestEntityTooLarge, false},
+		"undeclared over":  {"0123456789", -1, http.StatusRequestEntityTooLarge, true},
+		"undeclared under": {"0123", -1, http.StatusNoContent, true},
+	}
+	for name, tt := range tests {
+		body := &testReadCounter{Reader: strings.NewReader(tt.body)}
+		req := httptest.NewRequest(http.MethodPost, "/upload", nil)
+		req.Body = body
+		req.ContentLength = tt.length
+		req.Header.Set("Expect", "100-continue")
+		w := testServe(LimitRequestBody(8)(h), req)
+		if w.Code != tt.code {
+			t.Errorf("TestLimitRequestBody %s: status %d, expected %d", name, w.Code, tt.code)
+		}
+		if (body.reads > 0) != tt.read {
+			t.Errorf("TestLimitRequestBody %s: body read %t, expected %t", name, body.reads > 0, tt.read)
+		}
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	var calls int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := Coalesce()(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+		}
+		<-release
+		w.Header().Set("X-Test", "test")
+		RenderPlain(w, "report", http.StatusOK)
+	}))
+	const n = 5
+	var wg sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = testServe(h, httptest.NewRequest(http.MethodGet, "/report?year=2024", nil))
+		}(i)
+	}
+	<-started
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("TestCoalesce: handler ran %d times, expected 1", calls)
+	}
+	for i, w := range responses {
+		if w.Code != http.StatusOK || w.Header().Get("X-Test") != "test" || w.Body.String() != "report\n" {
+			t.Errorf("TestCoalesce %d: status %d header %q body %q", i, w.Code, w.Header().Get("X-Test"), w.Body.String())
+		}
+	}
+	testServe(h, httptest.NewRequest(http.MethodPost, "/report?year=2024", nil))
+	if calls != 2 {
+		t.Errorf("TestCoalesce: POST handler ran %d times, expected 2", calls)
+	}
+}
+
+func TestCoalesceCancel(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := Coalesce()(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		close(started)
+		<-release
+		if req.Context().Err() != nil {
+			t.Errorf("TestCoalesceCancel: %v", req.Context().Err())
+		}
+		RenderPlain(w, "report", http.StatusOK)
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan *httptest.ResponseRecorder)
+	go func() {
+		req := httptest.NewRequest(http.MethodGet, "/report", nil).WithContext(ctx)
+		first <- testServe(h, req)
+	}()
+	<-started
+	second := make(chan *httptest.ResponseRecorder)
+	go func() {
+		second <- testServe(h, httptest.NewRequest(http.MethodGet, "/report", nil))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-first
+	close(release)
+	w := <-second
+	if w.Code != http.StatusOK || w.Body.String() != "report\n" {
+		t.Errorf("TestCoalesceCancel: status %d body %q", w.Code, w.Body.String())
+	}
+}
+
+func TestCoalesceCredentials(t *testing.T) {
+	var calls int32
+	arrived := make(chan struct{}, 4)
+	release := make(chan struct{})
+	h := Coalesce()(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		arrived <- struct{}{}
+		<-release
+		user := req.Header.Get("Authorization")
+		if c, err := req.Cookie("session"); err == nil {
+			user = c.Value
+		}
+		SetCookie(w, &http.Cookie{Name: "user", Value: user})
+		RenderPlain(w, user, http.StatusOK)
+	}))
+	users := []struct {
+		header string
+		value  string
+	}{
+		{"Authorization", "alice"},
+		{"Authorization", "bob"},
+		{"Cookie", "session=carol"},
+		{"Cookie", "session=dave"},
+	}
+	var wg sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, len(users))
+	for i, u := range users {
+		wg.Add(1)
+		go func(i int, header, value string) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/profile", nil)
+			req.Header.Set(header, value)
+			responses[i] = testServe(h, req)
+		}(i, u.header, u.value)
+	}
+	for range users {
+		select {
+		case <-arrived:
+		case <-time.After(time.Second):
+			t.Fatalf("TestCoalesceCredentials: requests with different credentials were coalesced")
+		}
+	}
+	close(release)
+	wg.Wait()
+	if int(calls) != len(users) {
+		t.Errorf("TestCoalesceCredentials: handler ran %d times, expected %d", calls, len(users))
+	}
+	for i, w := range responses {
+		want := strings.TrimPrefix(users[i].value, "session=")
+		if w.Body.String() != want+"\n" || w.Header().Get("Set-Cookie") != "user="+want {
+			t.Errorf("TestCoalesceCredentials %s: body %q cookie %q", want, w.Body.String(), w.Header().Get("Set-Cookie"))
+		}
+	}
+}
+
+func TestRequireAccept(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	tests := map[string]struct {
+		types  []string
+		accept string
+		code   int
+	}{
+		"explicit":         {[]string{"application/json"}, "application/json", http.StatusOK},
+		"explicit params":  {[]string{"application/json"}, "text/html;q=0.9, application/json;charset=utf-8", http.StatusOK},
+		"case":             {[]string{"application/JSON"}, "Application/Json", http.StatusOK},
+		"other":            {[]string{"application/json"}, "text/html", http.StatusNotAcceptable},
+		"excluded":         {[]string{"application/json"}, "application/json;q=0", http.StatusNotAcceptable},
+		"wildcard":         {[]string{"application/json"}, "*/*", http.StatusNotAcceptable},
+		"subtype wildcard": {[]string{"application/json"}, "application/*", http.StatusNotAcceptable},
+		"missing":          {[]string{"application/json"}, "", http.StatusNotAcceptable},
+		"wildcard allowed": {[]string{"application/json", "*/*"}, "*/*", http.StatusOK},
+		"multiple types":   {[]string{"application/json", "application/xml"}, "application/xml", http.StatusOK},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		RequireAccept(tt.types...)(h).ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Errorf("TestRequireAccept %s: status %d, expected %d", name, w.Code, tt.code)
+		}
+	}
+}
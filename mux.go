@@ -2,7 +2,17 @@ package httpc
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"goji.io"
 	"goji.io/middleware"
@@ -11,9 +21,21 @@ import (
 )
 
 // Mux represents an HTTP request multiplexer.
+//
+// Routes are matched in the order they are registered and the first
+// matching route wins. When patterns overlap, such as /files/special
+// and /files/:name, register the more specific pattern first.
 type Mux struct {
 	*goji.Mux
-	errorHandler http.Handler
+	errorHandler     http.Handler
+	preflightHandler http.Handler
+	methodHandler    http.Handler
+	middleware       []func(Handler) Handler
+	manualHead       bool
+	jsonOnly         bool
+	redirectSlash    bool
+	render           renderOptions
+	routes           []*route
 }
 
 // Handler represents a HTTP handler with error handling.
@@ -21,77 +43,484 @@ type Handler func(w http.ResponseWriter, req *http.Request) error
 
 // NewMux returns a new mux.
 func NewMux() *Mux {
-	return &Mux{
-		Mux:          goji.NewMux(),
-		errorHandler: http.HandlerFunc(defaultErrorHandler),
-	}
+	return newMux(goji.NewMux(), http.HandlerFunc(defaultErrorHandler))
 }
 
-// NewSubMux returns a new mux mounted at the given pattern p.
+// NewSubMux returns a new mux mounted at the given pattern p. The
+// sub-mux inherits the error handler, method not allowed handler,
+// HEAD handling, JSON only mode, trailing slash redirects and render
+// options of m.
 func (m *Mux) NewSubMux(p string) *Mux {
-	h := &Mux{Mux: goji.SubMux()}
+	h := newMux(goji.SubMux(), m.errorHandler)
+	h.methodHandler = m.methodHandler
+	h.manualHead = m.manualHead
+	h.jsonOnly = m.jsonOnly
+	h.redirectSlash = m.redirectSlash
+	h.render = m.render
 	m.Handle(p, h)
 	return h
 }
 
+// newMux returns a new mux wrapping the goji mux.
+func newMux(gm *goji.Mux, errorHandler http.Handler) *Mux {
+	m := &Mux{
+		Mux:           gm,
+		errorHandler:  errorHandler,
+		methodHandler: http.HandlerFunc(defaultMethodHandler),
+	}
+	m.Mux.Use(m.intercept)
+	return m
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (m *Mux) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if m.preflightHandler != nil && isPreflight(req) {
+		ctx := context.WithValue(req.Context(), keyPreflight, m.preflight(req))
+		req = req.WithContext(ctx)
+	}
+	m.Mux.ServeHTTP(w, req)
+}
+
+// intercept is the outermost middleware of the mux. It runs after
+// routing and before any middleware registered with Use.
+func (m *Mux) intercept(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		w = withRenderOptions(w, m.render)
+		if m.jsonOnly {
+			ctx := context.WithValue(req.Context(), keyJSONOnly, true)
+			req = req.WithContext(ctx)
+		}
+		if m.preflightHandler != nil && isPreflight(req) {
+			m.preflightHandler.ServeHTTP(w, req)
+			return
+		}
+		if middleware.Handler(req.Context()) == nil {
+			allow := m.allowed(req)
+			if len(allow) > 0 {
+				w.Header().Set("Allow", strings.Join(allow, ", "))
+				m.methodHandler.ServeHTTP(w, req)
+				return
+			}
+			if m.redirectSlash && m.redirectTrailingSlash(w, req) {
+				return
+			}
+			if isJSONOnly(req) {
+				abort(w, req, http.StatusNotFound)
+				return
+			}
+		}
+		h.ServeHTTP(w, req)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// allowed returns the sorted HTTP methods of the routes
+// matching the request path regardless of the method.
+func (m *Mux) allowed(req *http.Request) []string {
+	seen := make(map[string]bool)
+	var allow []string
+	for _, r := range m.routes {
+		methods := r.pattern.HTTPMethods()
+		if methods == nil {
+			continue
+		}
+		match := r.any.Match(req)
+		if match == nil || !matchWhere(match, r.where) {
+			continue
+		}
+		for method := range methods {
+			if !seen[method] {
+				seen[method] = true
+				allow = append(allow, method)
+			}
+		}
+	}
+	sort.Strings(allow)
+	return allow
+}
+
+// redirectTrailingSlash redirects the request to the path with the
+// trailing slash toggled if it matches a route of m, and reports
+// whether the request was redirected.
+func (m *Mux) redirectTrailingSlash(w http.ResponseWriter, req *http.Request) bool {
+	path := req.URL.EscapedPath()
+	if path == "/" || strings.HasPrefix(path, "//") {
+		return false
+	}
+	sub := pattern.Path(req.Context())
+	if strings.HasSuffix(path, "/") {
+		path = path[:len(path)-1]
+		sub = strings.TrimSuffix(sub, "/")
+	} else {
+		path += "/"
+		sub += "/"
+	}
+	ctx := pattern.SetPath(req.Context(), sub)
+	if !m.isKnownRoute(req.WithContext(ctx)) {
+		return false
+	}
+	if req.URL.RawQuery != "" {
+		path += "?" + req.URL.RawQuery
+	}
+	code := http.StatusPermanentRedirect
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		code = http.StatusMovedPermanently
+	}
+	http.Redirect(w, req, path, code)
+	return true
+}
+
+// isPreflight reports whether the request is a CORS preflight request.
+func isPreflight(req *http.Request) bool {
+	return req.Method == http.MethodOptions &&
+		req.Header.Get("Origin") != "" &&
+		req.Header.Get("Access-Control-Request-Method") != ""
+}
+
 // Any registers a route that matches any HTTP method.
-func (m *Mux) Any(p string, h Handler) {
-	m.handle(pat.New(p), h)
+func (m *Mux) Any(p string, h Handler, opts ...RouteOption) {
+	m.handle(pat.New(p), h, opts)
 }
 
 // Delete registers a route that only matches the DELETE HTTP method.
-func (m *Mux) Delete(p string, h Handler) {
-	m.handle(pat.Delete(p), h)
+func (m *Mux) Delete(p string, h Handler, opts ...RouteOption) {
+	m.handle(pat.Delete(p), h, opts)
 }
 
 // Get registers a route that only matches the GET and HEAD HTTP methods.
-// HEAD requests are handled transparently by net/http.
-func (m *Mux) Get(p string, h Handler) {
-	m.handle(pat.Get(p), h)
+// Unless disabled with SetAutoHead, HEAD requests run the handler with
+// the response body discarded and the Content-Length set to its size.
+func (m *Mux) Get(p string, h Handler, opts ...RouteOption) {
+	m.handle(pat.Get(p), h, opts)
+}
+
+// head returns a Handler that replies to HEAD requests
+// with the headers of the GET response of h.
+func (m *Mux) head(h Handler) Handler {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		if req.Method != http.MethodHead || m.manualHead {
+			return h(w, req)
+		}
+		hw := newHeadWriter(w)
+		err := h(hw, req)
+		if err != nil {
+			return err
+		}
+		return hw.commit(w)
+	}
+}
+
+// GetTimeout registers a route that only matches the GET and HEAD HTTP
+// methods and whose handler must complete within the duration d.
+// It is shorthand for m.Get(p, Timeout(h, d), opts...).
+func (m *Mux) GetTimeout(p string, h Handler, d time.Duration, opts ...RouteOption) {
+	m.Get(p, Timeout(h, d), opts...)
 }
 
 // Head registers a route that only matches the HEAD HTTP method.
-func (m *Mux) Head(p string, h Handler) {
-	m.handle(pat.Head(p), h)
+func (m *Mux) Head(p string, h Handler, opts ...RouteOption) {
+	m.handle(pat.Head(p), h, opts)
 }
 
 // Options registers a route that only matches the OPTIONS HTTP method.
-func (m *Mux) Options(p string, h Handler) {
-	m.handle(pat.Options(p), h)
+func (m *Mux) Options(p string, h Handler, opts ...RouteOption) {
+	m.handle(pat.Options(p), h, opts)
 }
 
 // Patch registers a route that only matches the PATCH HTTP method.
-func (m *Mux) Patch(p string, h Handler) {
-	m.handle(pat.Patch(p), h)
+func (m *Mux) Patch(p string, h Handler, opts ...RouteOption) {
+	m.handle(pat.Patch(p), h, opts)
 }
 
 // Post registers a route that only matches the POST HTTP method.
-func (m *Mux) Post(p string, h Handler) {
-	m.handle(pat.Post(p), h)
+func (m *Mux) Post(p string, h Handler, opts ...RouteOption) {
+	m.handle(pat.Post(p), h, opts)
 }
 
 // Put registers a route that only matches the PUT HTTP method.
-func (m *Mux) Put(p string, h Handler) {
-	m.handle(pat.Put(p), h)
+func (m *Mux) Put(p string, h Handler, opts ...RouteOption) {
+	m.handle(pat.Put(p), h, opts)
+}
+
+// UseC appends Handler middleware to the middleware chain of the routes
+// registered with the route methods of m, such as Get and Post. The
+// middleware runs in the order it was appended, after any middleware
+// registered with Use, and may short-circuit the chain by returning an
+// error that is passed to the error handler. Routes of sub-muxes and
+// routes registered with Handle are not affected.
+func (m *Mux) UseC(mw ...func(Handler) Handler) {
+	m.middleware = append(m.middleware, mw...)
 }
 
+// OnError is called with every non-nil error returned by a Handler
+// before the error handler is invoked. It is intended for observing
+// errors for metrics and alerting and must not write the response.
+var OnError func(req *http.Request, err error)
+
 // handle registers a route with the mux.
-func (m *Mux) handle(p *pat.Pattern, h Handler) {
+func (m *Mux) handle(p *pat.Pattern, h Handler, opts []RouteOption) {
+	r := &route{pattern: p, any: pat.New(p.String()), handler: h}
+	for _, opt := range opts {
+		opt(r)
+	}
+	m.routes = append(m.routes, r)
+	if _, ok := p.HTTPMethods()[http.MethodGet]; ok {
+		h = m.head(h)
+	}
 	fn := func(w http.ResponseWriter, req *http.Request) {
-		err := h(w, req)
+		next := h
+		for i := len(m.middleware) - 1; i >= 0; i-- {
+			next = m.middleware[i](next)
+		}
+		err := next(w, req)
 		if err != nil {
+			if OnError != nil {
+				OnError(req, err)
+			}
+			if errors.Is(err, ErrClientDisconnected) {
+				Logger(req).LogAttrs(req.Context(), slog.LevelDebug, "httpc: client disconnected", slog.String("error", err.Error()))
+				return
+			}
 			ctx := req.Context()
 			ctx = context.WithValue(ctx, keyError, err)
 			req = req.WithContext(ctx)
 			m.errorHandler.ServeHTTP(w, req)
 		}
 	}
-	m.HandleFunc(p, fn)
+	m.HandleFunc(&routePattern{Pattern: p, route: r}, fn)
+}
+
+// Buffered returns a Handler that buffers the response written by h and
+// commits it only if h returns a nil error. Otherwise the buffered
+// response is discarded so that the error handler can write a clean
+// response. This enables all or nothing responses for handlers that
+// write their response before committing a transaction.
+func Buffered(h Handler) Handler {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		bw := newBufferedWriter(w)
+		err := h(bw, req)
+		if err != nil {
+			return err
+		}
+		return bw.commit(w)
+	}
+}
+
+// A ViewFunc returns the view and status code of the response to
+// the request. A zero status code is http.StatusOK, or
+// http.StatusNoContent if the view is nil.
+type ViewFunc func(req *http.Request) (Viewable, int, error)
+
+// JSON returns a Handler that renders the view returned by fn as JSON
+// with RenderJSON. A nil view is replied to with the status code and
+// no body. Errors returned by fn are passed to the error handler.
+func JSON(fn ViewFunc) Handler {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		view, code, err := fn(req)
+		if err != nil {
+			return err
+		}
+		code = viewStatus(view, code)
+		if view == nil {
+			w.WriteHeader(code)
+			return nil
+		}
+		return RenderJSON(w, view, code)
+	}
+}
+
+// Negotiated returns a Handler that renders the view returned by fn in
+// the requested format with Render. A nil view is replied to with the
+// status code and no body. Errors returned by fn are passed to the
+// error handler.
+func Negotiated(fn ViewFunc) Handler {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		view, code, err := fn(req)
+		if err != nil {
+			return err
+		}
+		code = viewStatus(view, code)
+		if view == nil {
+			w.WriteHeader(code)
+			return nil
+		}
+		return Render(w, req, view, code)
+	}
+}
+
+// viewStatus returns the status code of the response to a ViewFunc.
+func viewStatus(view Viewable, code int) int {
+	switch {
+	case code != 0:
+		return code
+	case view == nil:
+		return http.StatusNoContent
+	}
+	return http.StatusOK
+}
+
+// Timeout returns a Handler that runs h with a request context deadline
+// of d. The response is buffered and only written if h returns in time.
+// Otherwise the buffered response is discarded and ErrTimeout is returned,
+// which the default error handler replies to with http.StatusGatewayTimeout.
+//
+// The request body can not be read by h once the deadline is exceeded,
+// since h continues to run until it returns. Panics in h are re-panicked
+// with the stack of h if it returns in time, or logged to the request
+// Logger otherwise.
+func Timeout(h Handler, d time.Duration) Handler {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), d)
+		defer cancel()
+		// The buffered writer does not unwrap to w, which h
+		// may not use once the deadline is exceeded.
+		bw := &bufferedWriter{
+			w:      &renderWriter{opts: renderOptionsOf(w)},
+			header: w.Header().Clone(),
+		}
+		r := req.WithContext(ctx)
+		var body *timeoutBody
+		if req.Body != nil && req.Body != http.NoBody {
+			body = &timeoutBody{rc: req.Body}
+			r.Body = body
+		}
+		done := make(chan error, 1)
+		panicked := make(chan interface{})
+		timedOut := make(chan struct{})
+		go func() {
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v != http.ErrAbortHandler {
+					v = &panicError{value: v, stack: debug.Stack()}
+				}
+				select {
+				case panicked <- v:
+				case <-timedOut:
+					pe, ok := v.(*panicError)
+					if ok {
+						Logger(req).LogAttrs(req.Context(), slog.LevelError, "httpc: panic serving request after timeout",
+							slog.Any("panic", pe.value), slog.String("stack", string(pe.stack)))
+					}
+				}
+			}()
+			done <- h(bw, r)
+		}()
+		select {
+		case v := <-panicked:
+			panic(v)
+		case err := <-done:
+			if err != nil {
+				return err
+			}
+			return bw.commit(w)
+		case <-ctx.Done():
+			close(timedOut)
+			if body != nil {
+				http.NewResponseController(w).SetReadDeadline(time.Now())
+				body.close()
+				w.Header().Set("Connection", "close")
+			}
+			if req.Context().Err() != nil {
+				return req.Context().Err()
+			}
+			return ErrTimeout
+		}
+	}
+}
+
+// timeoutBody is a request body that can no longer be read once closed
+// by Timeout, so that a handler running past its deadline does not read
+// the body concurrently with the server.
+type timeoutBody struct {
+	mu     sync.Mutex
+	rc     io.ReadCloser
+	closed bool
+}
+
+// Read implements the io.Reader interface.
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return 0, ErrTimeout
+	}
+	return b.rc.Read(p)
+}
+
+// Close implements the io.Closer interface.
+func (b *timeoutBody) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	return b.rc.Close()
+}
+
+// close prevents further reads of the body, waiting
+// for a read in progress, if any, to return.
+func (b *timeoutBody) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+}
+
+// panicError is a panic recovered from a handler goroutine with the
+// stack of the goroutine, for re-panicking on the serving goroutine.
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+// Error implements the error interface.
+func (e *panicError) Error() string {
+	return fmt.Sprintf("%v\n\n%s", e.value, e.stack)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *panicError) Unwrap() error {
+	err, _ := e.value.(error)
+	return err
 }
 
 // Handle registers a standard net/http route with the mux.
 func (m *Mux) Handle(p string, h http.Handler) {
-	m.Mux.Handle(pat.New(p), h)
+	pp := pat.New(p)
+	sub, _ := h.(*Mux)
+	m.routes = append(m.routes, &route{pattern: pp, any: pp, mux: sub})
+	m.Mux.Handle(pp, h)
+}
+
+// IsKnownRoute reports whether the path matches a route registered
+// with m or any of its sub-muxes, regardless of the HTTP method. The
+// handler is not executed. It is intended for validating redirect
+// targets derived from user input, such as a ?next= query parameter.
+// Absolute URLs never match.
+func IsKnownRoute(m *Mux, path string) bool {
+	u, err := url.Parse(path)
+	if err != nil || u.Scheme != "" || u.Host != "" || !strings.HasPrefix(u.Path, "/") {
+		return false
+	}
+	req := &http.Request{Method: http.MethodGet, URL: u}
+	ctx := pattern.SetPath(context.Background(), u.EscapedPath())
+	return m.isKnownRoute(req.WithContext(ctx))
+}
+
+// isKnownRoute reports whether the request path matches a route of m.
+func (m *Mux) isKnownRoute(req *http.Request) bool {
+	for _, r := range m.routes {
+		match := r.any.Match(req)
+		if match == nil || !matchWhere(match, r.where) {
+			continue
+		}
+		if r.mux == nil || r.mux.isKnownRoute(match) {
+			return true
+		}
+	}
+	return false
 }
 
 // FileServer registers a file system with the mux.
@@ -109,6 +538,74 @@ func (m *Mux) SetErrorHandler(h http.Handler) {
 	m.errorHandler = h
 }
 
+// SetAutoHead sets whether HEAD requests to routes registered with Get
+// are answered automatically. It is enabled by default. When disabled,
+// HEAD requests are passed to the handler as is and net/http discards
+// the response body.
+func (m *Mux) SetAutoHead(enabled bool) {
+	m.manualHead = !enabled
+}
+
+// SetRedirectTrailingSlash sets whether requests that match no route are
+// redirected to the path with the trailing slash added or removed if it
+// matches a route, such as /users/ to /users. GET and HEAD requests are
+// redirected with http.StatusMovedPermanently and other methods with
+// http.StatusPermanentRedirect. It is disabled by default.
+func (m *Mux) SetRedirectTrailingSlash(enabled bool) {
+	m.redirectSlash = enabled
+}
+
+// SetMethodNotAllowedHandler sets the http.Handler to delegate to when
+// the request path matches a route but the request method does not.
+// The Allow header is set to the methods of the matching routes before
+// h is called. The default handler replies with
+// http.StatusMethodNotAllowed.
+func (m *Mux) SetMethodNotAllowedHandler(h http.Handler) {
+	m.methodHandler = h
+}
+
+// SetJSONOnly sets whether the mux serves JSON only. When enabled,
+// Render writes views with RenderJSON regardless of the Accept header
+// and the default handlers reply with a JSON error object. Explicit
+// calls to other render functions, such as RenderPlain, are honored.
+func (m *Mux) SetJSONOnly(enabled bool) {
+	m.jsonOnly = enabled
+}
+
+// SetEmptyCollections sets whether nil slices and maps are rendered as
+// empty JSON arrays and objects rather than null by the render functions.
+// Types that implement json.Marshaler or encoding.TextMarshaler and byte
+// slices are left as is. It is disabled by default.
+func (m *Mux) SetEmptyCollections(enabled bool) {
+	m.render.emptyCollections = enabled
+}
+
+// SetCharset sets whether the render functions include the charset=utf-8
+// parameter in the Content-Type header, for clients that mis-parse it. It
+// is enabled by default. Rendered bodies are always encoded as UTF-8, so
+// other charsets are not supported.
+func (m *Mux) SetCharset(enabled bool) {
+	m.render.omitCharset = !enabled
+}
+
+// isJSONOnly reports whether the request is served by a JSON only mux.
+func isJSONOnly(req *http.Request) bool {
+	v, _ := req.Context().Value(keyJSONOnly).(bool)
+	return v
+}
+
+// SetPreflightHandler sets the http.Handler to delegate to for CORS
+// preflight requests. Preflight requests are answered before any
+// middleware registered with Use runs, so that middleware such as
+// authentication does not reject them. The methods and headers
+// allowed by the routes matching the request path are available
+// to h with PreflightAllowed. See PreflightHandler. Routes registered with Options
+// only receive OPTIONS requests that are not preflight requests
+// while a preflight handler is set.
+func (m *Mux) SetPreflightHandler(h http.Handler) {
+	m.preflightHandler = h
+}
+
 // Error returns the error response if any.
 func Error(req *http.Request) error {
 	err, ok := req.Context().Value(keyError).(error)
@@ -131,11 +628,13 @@ func Path(req *http.Request) string {
 // Pattern returns the pattern corresponding to the most
 // recently matched pattern, or nil if no pattern was matched.
 func Pattern(req *http.Request) *pat.Pattern {
-	p := middleware.Pattern(req.Context())
-	if p == nil {
-		return nil
+	switch p := middleware.Pattern(req.Context()).(type) {
+	case *pat.Pattern:
+		return p
+	case *routePattern:
+		return p.Pattern
 	}
-	return p.(*pat.Pattern)
+	return nil
 }
 
 // Query returns the first query value associated with the given key.
@@ -145,7 +644,114 @@ func Query(req *http.Request, name string) string {
 	return req.URL.Query().Get(name)
 }
 
-// defaultErrorHandler is the default error handler.
+// QueryList returns the values of the query parameter with the given
+// name split on sep, such as ?ids=1,2,3. The values are trimmed and
+// empty values are omitted. Repeated parameters are combined. If there
+// are no values, QueryList returns an empty slice.
+func QueryList(req *http.Request, name, sep string) []string {
+	values := []string{}
+	for _, v := range req.URL.Query()[name] {
+		for _, s := range strings.Split(v, sep) {
+			s = strings.TrimSpace(s)
+			if s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
+
+// A SortField is a field to sort by parsed by ParseSort.
+type SortField struct {
+	// Column is the safe column name mapped from the requested field.
+	Column string
+
+	// Desc reports whether the field is sorted in descending order.
+	Desc bool
+}
+
+// ParseSort parses the comma separated sort fields of the query
+// parameter with the given name, such as ?sort=name,-created. A field
+// prefixed with a hyphen is sorted in descending order. Each field is
+// mapped to a column with allowed, so that only the allowed columns
+// are passed on to queries. An error wrapping ErrInvalidSort is
+// returned for fields that are not allowed or are repeated.
+func ParseSort(req *http.Request, name string, allowed map[string]string) ([]SortField, error) {
+	values := QueryList(req, name, ",")
+	fields := make([]SortField, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		field, desc := strings.CutPrefix(v, "-")
+		if !desc {
+			field = strings.TrimPrefix(field, "+")
+		}
+		column, ok := allowed[field]
+		if !ok || seen[field] {
+			return nil, fmt.Errorf("%w %q", ErrInvalidSort, v)
+		}
+		seen[field] = true
+		fields = append(fields, SortField{Column: column, Desc: desc})
+	}
+	return fields, nil
+}
+
+// defaultMethodHandler is the default method not allowed handler.
+func defaultMethodHandler(w http.ResponseWriter, req *http.Request) {
+	abort(w, req, http.StatusMethodNotAllowed)
+}
+
+// DebugErrors enables the inclusion of error details in the responses
+// of the default error handler and the stack of panics recovered by
+// Recover. It exposes internals to clients and must only be enabled in
+// development. If false, only the status text is written.
+var DebugErrors bool
+
+// defaultErrorHandler is the default error handler. The request ID,
+// if any, is included in the response header and body so that users
+// may report it for the error to be found in the logs.
 func defaultErrorHandler(w http.ResponseWriter, req *http.Request) {
-	Abort(w, http.StatusInternalServerError)
+	err := Error(req)
+	code := statusCode(err)
+	msg := http.StatusText(code)
+	var se *StatusError
+	if errors.As(err, &se) {
+		code = se.Code
+		msg = se.Error()
+	}
+	var detail string
+	if DebugErrors && err != nil && err.Error() != msg {
+		detail = err.Error()
+	}
+	id := RequestID(req)
+	if id != "" {
+		w.Header().Set("X-Request-ID", id)
+	}
+	if isJSONOnly(req) {
+		RenderJSON(w, jsonError{Error: msg, Status: code, Detail: detail, RequestID: id}, code)
+		return
+	}
+	if detail != "" {
+		msg += "\nerror: " + detail
+	}
+	if id != "" {
+		msg += "\nrequest id: " + id
+	}
+	RenderPlain(w, msg, code)
+}
+
+// jsonError is the JSON error object of a JSON only mux.
+type jsonError struct {
+	Error     string `json:"error"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// abort replies to the request with a default error,
+// as a JSON error object if the mux is JSON only.
+func abort(w http.ResponseWriter, req *http.Request, code int) error {
+	if isJSONOnly(req) {
+		return RenderJSON(w, jsonError{Error: http.StatusText(code), Status: code}, code)
+	}
+	return Abort(w, code)
 }
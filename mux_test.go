@@ -0,0 +1,798 @@
+package httpc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMuxRouteOrder(t *testing.T) {
+	tests := map[string]struct {
+		first  string
+		second string
+		path   string
+		want   string
+	}{
+		"specific first static":   {"/files/special", "/files/:name", "/files/special", "/files/special"},
+		"specific first param":    {"/files/special", "/files/:name", "/files/other", "/files/:name"},
+		"wildcard first static":   {"/files/:name", "/files/special", "/files/special", "/files/:name"},
+		"wildcard first param":    {"/files/:name", "/files/special", "/files/other", "/files/:name"},
+		"prefix first":            {"/files/*", "/files/special", "/files/special", "/files/*"},
+		"prefix second":           {"/files/special", "/files/*", "/files/special", "/files/special"},
+		"prefix second unmatched": {"/files/special", "/files/*", "/files/a/b", "/files/*"},
+	}
+	for name, tt := range tests {
+		m := NewMux()
+		m.Get(tt.first, testPatternHandler)
+		m.Get(tt.second, testPatternHandler)
+		w := testServe(m, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Body.String() != tt.want {
+			t.Errorf("TestMuxRouteOrder %s: matched %q, expected %q", name, w.Body.String(), tt.want)
+		}
+	}
+}
+
+func testPatternHandler(w http.ResponseWriter, req *http.Request) error {
+	_, err := io.WriteString(w, Pattern(req).String())
+	return err
+}
+
+func testServe(h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestMuxGetTimeout(t *testing.T) {
+	m := NewMux()
+	m.GetTimeout("/slow", func(w http.ResponseWriter, req *http.Request) error {
+		select {
+		case <-time.After(time.Second):
+		case <-req.Context().Done():
+		}
+		_, err := io.WriteString(w, "slow")
+		return err
+	}, 10*time.Millisecond)
+	m.GetTimeout("/fast", func(w http.ResponseWriter, req *http.Request) error {
+		w.Header().Set("X-Fast", "1")
+		w.WriteHeader(http.StatusAccepted)
+		_, err := io.WriteString(w, "fast")
+		return err
+	}, time.Second, Name("fast"))
+	w := testServe(m, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("TestMuxGetTimeout slow: status %d, expected %d", w.Code, http.StatusGatewayTimeout)
+	}
+	w = testServe(m, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if w.Code != http.StatusAccepted || w.Body.String() != "fast" || w.Header().Get("X-Fast") != "1" {
+		t.Errorf("TestMuxGetTimeout fast: status %d body %q", w.Code, w.Body.String())
+	}
+	if u, err := m.URL("fast", nil); err != nil || u != "/fast" {
+		t.Errorf("TestMuxGetTimeout: URL %q error %v, expected route option applied", u, err)
+	}
+}
+
+func TestTimeoutPanic(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewMux()
+	m.Use(Recover(slog.New(slog.NewTextHandler(&buf, nil))))
+	m.GetTimeout("/panic", func(w http.ResponseWriter, req *http.Request) error {
+		testTimeoutPanic()
+		return nil
+	}, time.Second)
+	w := testServe(m, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("TestTimeoutPanic: status %d, expected %d", w.Code, http.StatusInternalServerError)
+	}
+	if !strings.Contains(buf.String(), "panic=boom") || !strings.Contains(buf.String(), "testTimeoutPanic") {
+		t.Errorf("TestTimeoutPanic: log missing panic stack\n%s", buf.String())
+	}
+}
+
+// testTimeoutPanic panics so that its frame is in the recovered stack.
+func testTimeoutPanic() {
+	panic("boom")
+}
+
+// testLogWriter sends each log record written to it to the channel.
+type testLogWriter chan string
+
+func (w testLogWriter) Write(b []byte) (int, error) {
+	w <- string(b)
+	return len(b), nil
+}
+
+func TestTimeoutLatePanic(t *testing.T) {
+	logs := make(testLogWriter, 1)
+	m := NewMux()
+	m.Use(RequestLogger(slog.New(slog.NewTextHandler(logs, nil))))
+	m.GetTimeout("/late", func(w http.ResponseWriter, req *http.Request) error {
+		<-req.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		panic("late boom")
+	}, 10*time.Millisecond)
+	w := testServe(m, httptest.NewRequest(http.MethodGet, "/late", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("TestTimeoutLatePanic: status %d, expected %d", w.Code, http.StatusGatewayTimeout)
+	}
+	select {
+	case v := <-logs:
+		if !strings.Contains(v, "after timeout") || !strings.Contains(v, "panic=\"late boom\"") || !strings.Contains(v, "path=/late") {
+			t.Errorf("TestTimeoutLatePanic: log %s", v)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("TestTimeoutLatePanic: panic not logged")
+	}
+}
+
+func TestTimeoutBody(t *testing.T) {
+	read := make(chan error, 1)
+	m := NewMux()
+	m.Post("/upload", Timeout(func(w http.ResponseWriter, req *http.Request) error {
+		<-req.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		_, err := io.ReadAll(req.Body)
+		read <- err
+		return err
+	}, 10*time.Millisecond))
+	w := testServe(m, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("body")))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("TestTimeoutBody: status %d, expected %d", w.Code, http.StatusGatewayTimeout)
+	}
+	if v := w.Header().Get("Connection"); v != "close" {
+		t.Errorf("TestTimeoutBody: Connection %q, expected close", v)
+	}
+	if err := <-read; err != ErrTimeout {
+		t.Errorf("TestTimeoutBody: read error %v, expected %v", err, ErrTimeout)
+	}
+}
+
+func TestOnError(t *testing.T) {
+	defer func(fn func(*http.Request, error)) { OnError = fn }(OnError)
+	want := errors.New("boom")
+	var got error
+	var path string
+	OnError = func(req *http.Request, err error) {
+		got = err
+		path = req.URL.Path
+	}
+	m := NewMux()
+	m.Get("/fail", func(w http.ResponseWriter, req *http.Request) error {
+		return want
+	})
+	m.Get("/ok", func(w http.ResponseWriter, req *http.Request) error {
+		return nil
+	})
+	w := testServe(m, httptest.NewRequest(http.MethodGet, "/ok", nil))
+	if got != nil {
+		t.Errorf("TestOnError: observer called without error")
+	}
+	w = testServe(m, httptest.NewRequest(http.MethodGet, "/fail", nil))
+	if got != want || path != "/fail" {
+		t.Errorf("TestOnError: observed (%v, %q), expected (%v, /fail)", got, path, want)
+	}
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("TestOnError: status %d, expected %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestMuxPreflight(t *testing.T) {
+	m := NewMux()
+	m.Use(func(h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, req *http.Request) {
+			if req.Header.Get("Authorization") == "" {
+				Abort(w, http.StatusUnauthorized)
+				return
+			}
+			h.ServeHTTP(w, req)
+		}
+		return http.HandlerFunc(fn)
+	})
+	m.SetPreflightHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", req.Header.Get("Origin"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	m.Options("/items", func(w http.ResponseWriter, req *http.Request) error {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		return NoContent(w)
+	})
+	m.Get("/items", func(w http.ResponseWriter, req *http.Request) error {
+		return nil
+	})
+	tests := map[string]struct {
+		method string
+		header http.Header
+		code   int
+	}{
+		"preflight":      {http.MethodOptions, http.Header{"Origin": {"https://example.com"}, "Access-Control-Request-Method": {"GET"}}, http.StatusNoContent},
+		"options":        {http.MethodOptions, http.Header{}, http.StatusUnauthorized},
+		"options authed": {http.MethodOptions, http.Header{"Authorization": {"Bearer x"}}, http.StatusNoContent},
+		"get":            {http.MethodGet, http.Header{"Origin": {"https://example.com"}}, http.StatusUnauthorized},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/items", nil)
+		req.Header = tt.header
+		w := testServe(m, req)
+		if w.Code != tt.code {
+			t.Errorf("TestMuxPreflight %s: status %d, expected %d", name, w.Code, tt.code)
+		}
+	}
+}
+
+func TestMuxSubMuxErrorHandler(t *testing.T) {
+	m := NewMux()
+	m.SetErrorHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		Abort(w, http.StatusTeapot)
+	}))
+	sub := m.NewSubMux("/sub/*")
+	sub.Get("/fail", func(w http.ResponseWriter, req *http.Request) error {
+		return errors.New("boom")
+	})
+	w := testServe(m, httptest.NewRequest(http.MethodGet, "/sub/fail", nil))
+	if w.Code != http.StatusTeapot {
+		t.Errorf("TestMuxSubMuxErrorHandler: status %d, expected %d", w.Code, http.StatusTeapot)
+	}
+}
+
+func TestBuffered(t *testing.T) {
+	m := NewMux()
+	m.Post("/commit", Buffered(func(w http.ResponseWriter, req *http.Request) error {
+		w.Header().Set("Location", "/items/1")
+		return RenderPlain(w, "created", http.StatusCreated)
+	}))
+	m.Post("/rollback", Buffered(func(w http.ResponseWriter, req *http.Request) error {
+		w.Header().Set("Location", "/items/1")
+		err := RenderPlain(w, "created", http.StatusCreated)
+		if err != nil {
+			return err
+		}
+		return errors.New("commit failed")
+	}))
+	w := testServe(m, httptest.NewRequest(http.MethodPost, "/commit", nil))
+	if w.Code != http.StatusCreated || w.Body.String() != "created\n" || w.Header().Get("Location") != "/items/1" {
+		t.Errorf("TestBuffered commit: status %d body %q", w.Code, w.Body.String())
+	}
+	w = testServe(m, httptest.NewRequest(http.MethodPost, "/rollback", nil))
+	if w.Code != http.StatusInternalServerError || w.Body.String() != "Internal Server Error\n" || w.Header().Get("Location") != "" {
+		t.Errorf("TestBuffered rollback: status %d body %q", w.Code, w.Body.String())
+	}
+}
+
+func TestBufferedInformational(t *testing.T) {
+	h := func(w http.ResponseWriter, req *http.Request) error {
+		w.WriteHeader(http.StatusContinue)
+		w.WriteHeader(http.StatusEarlyHints)
+		return RenderPlain(w, "created", http.StatusCreated)
+	}
+	m := NewMux()
+	m.Post("/buffered", Buffered(h))
+	m.GetTimeout("/timeout", h, time.Second)
+	m.Get("/head", h)
+	tests := map[string]*http.Request{
+		"buffered": httptest.NewRequest(http.MethodPost, "/buffered", nil),
+		"timeout":  httptest.NewRequest(http.MethodGet, "/timeout", nil),
+		"head":     httptest.NewRequest(http.MethodHead, "/head", nil),
+	}
+	for name, req := range tests {
+		w := testServe(m, req)
+		if w.Code != http.StatusCreated {
+			t.Errorf("TestBufferedInformational %s: status %d, expected %d", name, w.Code, http.StatusCreated)
+		}
+	}
+}
+
+func TestBufferedUnwrap(t *testing.T) {
+	var err error
+	m := NewMux()
+	m.Post("/", Buffered(func(w http.ResponseWriter, req *http.Request) error {
+		rc := http.NewResponseController(w)
+		if rc.Flush() == nil {
+			return errors.New("flushed around the buffer")
+		}
+		err = rc.SetReadDeadline(time.Now().Add(time.Second))
+		return RenderPlain(w, "ok", http.StatusOK)
+	}))
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+	resp, perr := http.Post(srv.URL, "text/plain", nil)
+	if perr != nil {
+		t.Fatalf("TestBufferedUnwrap: %v", perr)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("TestBufferedUnwrap: status %d", resp.StatusCode)
+	}
+	if err != nil {
+		t.Errorf("TestBufferedUnwrap: SetReadDeadline %v", err)
+	}
+}
+
+func TestIsKnownRoute(t *testing.T) {
+	m := NewMux()
+	m.Get("/", testPatternHandler)
+	m.Post("/users/:id", testPatternHandler)
+	sub := m.NewSubMux("/admin/*")
+	sub.Get("/settings", testPatternHandler)
+	tests := map[string]struct {
+		path string
+		want bool
+	}{
+		"root":             {"/", true},
+		"param":            {"/users/1", true},
+		"param with query": {"/users/1?tab=profile", true},
+		"sub-mux":          {"/admin/settings", true},
+		"unknown":          {"/unknown", false},
+		"unknown sub-mux":  {"/admin/unknown", false},
+		"relative":         {"users/1", false},
+		"absolute":         {"https://example.com/", false},
+		"scheme relative":  {"//example.com/", false},
+	}
+	for name, tt := range tests {
+		have := IsKnownRoute(m, tt.path)
+		if have != tt.want {
+			t.Errorf("TestIsKnownRoute %s: %t, expected %t", name, have, tt.want)
+		}
+	}
+}
+
+func TestMuxAutoHead(t *testing.T) {
+	h := func(w http.ResponseWriter, req *http.Request) error {
+		w.Header().Set("X-Test", "test")
+		return RenderPlain(w, "hello, world", http.StatusOK)
+	}
+	tests := map[string]struct {
+		enabled bool
+		length  string
+		body    string
+	}{
+		"enabled":  {true, "13", ""},
+		"disabled": {false, "", "hello, world\n"},
+	}
+	for name, tt := range tests {
+		m := NewMux()
+		m.SetAutoHead(tt.enabled)
+		m.Get("/", h)
+		get := testServe(m, httptest.NewRequest(http.MethodGet, "/", nil))
+		head := testServe(m, httptest.NewRequest(http.MethodHead, "/", nil))
+		if head.Code != get.Code {
+			t.Errorf("TestMuxAutoHead %s: status %d, expected %d", name, head.Code, get.Code)
+		}
+		for _, k := range []string{"Content-Type", "X-Content-Type-Options", "X-Test"} {
+			if head.Header().Get(k) != get.Header().Get(k) {
+				t.Errorf("TestMuxAutoHead %s: %s %q, expected %q", name, k, head.Header().Get(k), get.Header().Get(k))
+			}
+		}
+		if head.Header().Get("Content-Length") != tt.length {
+			t.Errorf("TestMuxAutoHead %s: Content-Length %q, expected %q", name, head.Header().Get("Content-Length"), tt.length)
+		}
+		if head.Body.String() != tt.body {
+			t.Errorf("TestMuxAutoHead %s: body %q, expected %q", name, head.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestMuxAutoHeadStream(t *testing.T) {
+	m := NewMux()
+	m.Get("/", func(w http.ResponseWriter, req *http.Request) error {
+		events := make(chan Event, 1)
+		events <- Event{Data: "hello"}
+		close(events)
+		return RenderEventStream(w, req, events)
+	})
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		w := testServe(m, httptest.NewRequest(method, "/", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("TestMuxAutoHeadStream %s: status %d, expected %d", method, w.Code, http.StatusOK)
+		}
+		if v := w.Header().Get("Content-Type"); v != "text/event-stream" {
+			t.Errorf("TestMuxAutoHeadStream %s: Content-Type %q", method, v)
+		}
+		if !w.Flushed {
+			t.Errorf("TestMuxAutoHeadStream %s: expected flush", method)
+		}
+		if method == http.MethodHead && (w.Body.Len() > 0 || w.Header().Get("Content-Length") != "") {
+			t.Errorf("TestMuxAutoHeadStream %s: body %q, Content-Length %q", method, w.Body.String(), w.Header().Get("Content-Length"))
+		}
+	}
+}
+
+func TestMuxWhere(t *testing.T) {
+	m := NewMux()
+	m.Get("/users/:id", testPatternHandler, Where("id", "[0-9]+"))
+	m.Get("/users/new", testPatternHandler)
+	m.Get("/posts/:slug", testPatternHandler, Where("slug", "[a-z]+"))
+	tests := map[string]struct {
+		path string
+		code int
+		want string
+	}{
+		"numeric":      {"/users/42", http.StatusOK, "/users/:id"},
+		"fall through": {"/users/new", http.StatusOK, "/users/new"},
+		"partial":      {"/users/42abc", http.StatusNotFound, ""},
+		"not found":    {"/posts/Hello", http.StatusNotFound, ""},
+		"constrained":  {"/posts/hello", http.StatusOK, "/posts/:slug"},
+	}
+	for name, tt := range tests {
+		w := testServe(m, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("TestMuxWhere %s: status %d, expected %d", name, w.Code, tt.code)
+		}
+		if tt.code == http.StatusOK && w.Body.String() != tt.want {
+			t.Errorf("TestMuxWhere %s: pattern %q, expected %q", name, w.Body.String(), tt.want)
+		}
+	}
+	if !IsKnownRoute(m, "/users/42") || IsKnownRoute(m, "/posts/Hello") {
+		t.Errorf("TestMuxWhere: IsKnownRoute ignored constraints")
+	}
+}
+
+func TestMuxAllowedAllocs(t *testing.T) {
+	allocs := func(n int) float64 {
+		m := NewMux()
+		for i := 0; i < n; i++ {
+			m.Get("/users/"+strconv.Itoa(i), testPatternHandler)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/unknown", nil)
+		return testing.AllocsPerRun(10, func() {
+			m.allowed(req)
+			m.isKnownRoute(req)
+		})
+	}
+	if a, b := allocs(1), allocs(100); a != b {
+		t.Errorf("TestMuxAllowedAllocs: %v allocations for 1 route, %v for 100 routes", a, b)
+	}
+}
+
+func TestMuxMethodNotAllowed(t *testing.T) {
+	m := NewMux()
+	m.Get("/users", testPatternHandler)
+	m.Post("/users", testPatternHandler)
+	m.Delete("/users/:id", testPatternHandler, Where("id", "[0-9]+"))
+	sub := m.NewSubMux("/admin/*")
+	sub.Put("/settings", testPatternHandler)
+	tests := map[string]struct {
+		method string
+		path   string
+		code   int
+		allow  string
+	}{
+		"allowed":           {http.MethodPost, "/users", http.StatusOK, ""},
+		"not allowed":       {http.MethodPut, "/users", http.StatusMethodNotAllowed, "GET, HEAD, POST"},
+		"param":             {http.MethodGet, "/users/1", http.StatusMethodNotAllowed, "DELETE"},
+		"param constrained": {http.MethodGet, "/users/new", http.StatusNotFound, ""},
+		"sub-mux":           {http.MethodGet, "/admin/settings", http.StatusMethodNotAllowed, "PUT"},
+		"not found":         {http.MethodGet, "/unknown", http.StatusNotFound, ""},
+	}
+	for name, tt := range tests {
+		w := testServe(m, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("TestMuxMethodNotAllowed %s: status %d, expected %d", name, w.Code, tt.code)
+		}
+		if v := w.Header().Get("Allow"); v != tt.allow {
+			t.Errorf("TestMuxMethodNotAllowed %s: Allow %q, expected %q", name, v, tt.allow)
+		}
+	}
+	m.SetMethodNotAllowedHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	w := testServe(m, httptest.NewRequest(http.MethodPut, "/users", nil))
+	if w.Code != http.StatusTeapot || w.Header().Get("Allow") != "GET, HEAD, POST" {
+		t.Errorf("TestMuxMethodNotAllowed custom: status %d Allow %q", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+func TestMuxUseC(t *testing.T) {
+	errDenied := errors.New("denied")
+	var order []string
+	trace := func(name string) func(Handler) Handler {
+		return func(h Handler) Handler {
+			return func(w http.ResponseWriter, req *http.Request) error {
+				order = append(order, name)
+				if req.URL.Query().Get("deny") == name {
+					return errDenied
+				}
+				return h(w, req)
+			}
+		}
+	}
+	m := NewMux()
+	m.SetErrorHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if Error(req) == errDenied {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	m.Use(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			order = append(order, "use")
+			h.ServeHTTP(w, req)
+		})
+	})
+	m.UseC(trace("first"), trace("second"))
+	m.Get("/", func(w http.ResponseWriter, req *http.Request) error {
+		order = append(order, "handler")
+		return NoContent(w)
+	})
+	tests := map[string]struct {
+		path  string
+		code  int
+		order string
+	}{
+		"chain":         {"/", http.StatusNoContent, "use first second handler"},
+		"short circuit": {"/?deny=first", http.StatusForbidden, "use first"},
+	}
+	for name, tt := range tests {
+		order = nil
+		w := testServe(m, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("TestMuxUseC %s: status %d, expected %d", name, w.Code, tt.code)
+		}
+		if have := strings.Join(order, " "); have != tt.order {
+			t.Errorf("TestMuxUseC %s: order %q, expected %q", name, have, tt.order)
+		}
+	}
+}
+
+func TestQueryList(t *testing.T) {
+	tests := map[string]struct {
+		query string
+		want  []string
+	}{
+		"absent":   {"", []string{}},
+		"empty":    {"ids=", []string{}},
+		"single":   {"ids=1", []string{"1"}},
+		"multiple": {"ids=1,2,3", []string{"1", "2", "3"}},
+		"trimmed":  {"ids=1,+2+,,3", []string{"1", "2", "3"}},
+		"repeated": {"ids=1,2&ids=3", []string{"1", "2", "3"}},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+		have := QueryList(req, "ids", ",")
+		if !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("TestQueryList %s: %q, expected %q", name, have, tt.want)
+		}
+	}
+}
+
+func TestMuxJSONOnly(t *testing.T) {
+	m := NewMux()
+	m.SetJSONOnly(true)
+	m.Get("/users/1", func(w http.ResponseWriter, req *http.Request) error {
+		return Render(w, req, testView{Name: "foo"}, http.StatusOK)
+	})
+	m.Get("/plain", func(w http.ResponseWriter, req *http.Request) error {
+		return RenderPlain(w, "foo", http.StatusOK)
+	})
+	m.Get("/fail", func(w http.ResponseWriter, req *http.Request) error {
+		return ErrTimeout
+	})
+	tests := map[string]struct {
+		method      string
+		path        string
+		code        int
+		contentType string
+		body        string
+	}{
+		"render":             {http.MethodGet, "/users/1", http.StatusOK, "application/json; charset=utf-8", `{"name":"foo"}`},
+		"explicit plain":     {http.MethodGet, "/plain", http.StatusOK, "text/plain; charset=utf-8", "foo\n"},
+		"error":              {http.MethodGet, "/fail", http.StatusGatewayTimeout, "application/json; charset=utf-8", `{"error":"Gateway Timeout","status":504}`},
+		"not found":          {http.MethodGet, "/unknown", http.StatusNotFound, "application/json; charset=utf-8", `{"error":"Not Found","status":404}`},
+		"method not allowed": {http.MethodPost, "/users/1", http.StatusMethodNotAllowed, "application/json; charset=utf-8", `{"error":"Method Not Allowed","status":405}`},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Accept", "text/html")
+		w := testServe(m, req)
+		if w.Code != tt.code {
+			t.Errorf("TestMuxJSONOnly %s: status %d, expected %d", name, w.Code, tt.code)
+		}
+		if v := w.Header().Get("Content-Type"); v != tt.contentType {
+			t.Errorf("TestMuxJSONOnly %s: Content-Type %q, expected %q", name, v, tt.contentType)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("TestMuxJSONOnly %s: body %q, expected %q", name, w.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestViewFunc(t *testing.T) {
+	m := NewMux()
+	m.Get("/json", JSON(func(req *http.Request) (Viewable, int, error) {
+		return map[string]string{"name": "foo"}, http.StatusCreated, nil
+	}))
+	m.Get("/json/default", JSON(func(req *http.Request) (Viewable, int, error) {
+		return map[string]string{"name": "foo"}, 0, nil
+	}))
+	m.Get("/json/nil", JSON(func(req *http.Request) (Viewable, int, error) {
+		return nil, 0, nil
+	}))
+	m.Get("/json/accepted", JSON(func(req *http.Request) (Viewable, int, error) {
+		return nil, http.StatusAccepted, nil
+	}))
+	m.Get("/json/error", JSON(func(req *http.Request) (Viewable, int, error) {
+		return nil, 0, NewStatusError(http.StatusConflict, errors.New("conflict"))
+	}))
+	m.Get("/negotiated", Negotiated(func(req *http.Request) (Viewable, int, error) {
+		return "foo", 0, nil
+	}))
+	tests := map[string]struct {
+		path        string
+		accept      string
+		code        int
+		contentType string
+		body        string
+	}{
+		"json":       {"/json", "", http.StatusCreated, "application/json; charset=utf-8", `{"name":"foo"}`},
+		"default":    {"/json/default", "text/html", http.StatusOK, "application/json; charset=utf-8", `{"name":"foo"}`},
+		"nil":        {"/json/nil", "", http.StatusNoContent, "", ""},
+		"nil code":   {"/json/accepted", "", http.StatusAccepted, "", ""},
+		"error":      {"/json/error", "", http.StatusConflict, "text/plain; charset=utf-8", "conflict"},
+		"negotiated": {"/negotiated", "text/plain", http.StatusOK, "text/plain; charset=utf-8", "foo"},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("Accept", tt.accept)
+		w := testServe(m, req)
+		if w.Code != tt.code {
+			t.Errorf("TestViewFunc %s: status %d, expected %d", name, w.Code, tt.code)
+		}
+		if v := w.Header().Get("Content-Type"); v != tt.contentType {
+			t.Errorf("TestViewFunc %s: content type %q, expected %q", name, v, tt.contentType)
+		}
+		if v := strings.TrimSpace(w.Body.String()); v != tt.body {
+			t.Errorf("TestViewFunc %s: body %q, expected %q", name, v, tt.body)
+		}
+	}
+}
+
+func TestDefaultErrorHandlerRequestID(t *testing.T) {
+	tests := map[string]struct {
+		id       string
+		jsonOnly bool
+		err      error
+		code     int
+		body     string
+	}{
+		"internal":    {"abc123", false, errors.New("boom"), http.StatusInternalServerError, "Internal Server Error\nrequest id: abc123\n"},
+		"status":      {"abc123", false, NewStatusError(http.StatusConflict, errors.New("conflict")), http.StatusConflict, "conflict\nrequest id: abc123\n"},
+		"json":        {"abc123", true, errors.New("boom"), http.StatusInternalServerError, `{"error":"Internal Server Error","status":500,"request_id":"abc123"}`},
+		"absent":      {"", false, errors.New("boom"), http.StatusInternalServerError, "Internal Server Error\n"},
+		"absent json": {"", true, errors.New("boom"), http.StatusInternalServerError, `{"error":"Internal Server Error","status":500}`},
+	}
+	for name, tt := range tests {
+		m := NewMux()
+		m.SetJSONOnly(tt.jsonOnly)
+		m.Get("/", func(w http.ResponseWriter, req *http.Request) error {
+			return tt.err
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.id != "" {
+			req.Header.Set("X-Request-ID", tt.id)
+		}
+		w := testServe(m, req)
+		if w.Code != tt.code {
+			t.Errorf("TestDefaultErrorHandlerRequestID %s: status %d, expected %d", name, w.Code, tt.code)
+		}
+		if v := w.Header().Get("X-Request-ID"); v != tt.id {
+			t.Errorf("TestDefaultErrorHandlerRequestID %s: header %q, expected %q", name, v, tt.id)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("TestDefaultErrorHandlerRequestID %s: body %q, expected %q", name, w.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestDefaultErrorHandlerDebugErrors(t *testing.T) {
+	defer func(v bool) { DebugErrors = v }(DebugErrors)
+	tests := map[string]struct {
+		debug    bool
+		jsonOnly bool
+		err      error
+		body     string
+	}{
+		"production":      {false, false, errors.New("db: connection refused"), "Internal Server Error\n"},
+		"production json": {false, true, errors.New("db: connection refused"), `{"error":"Internal Server Error","status":500}`},
+		"debug":           {true, false, errors.New("db: connection refused"), "Internal Server Error\nerror: db: connection refused\n"},
+		"debug json":      {true, true, errors.New("db: connection refused"), `{"error":"Internal Server Error","status":500,"detail":"db: connection refused"}`},
+		"debug status":    {true, false, NewStatusError(http.StatusConflict, errors.New("conflict")), "conflict\n"},
+	}
+	for name, tt := range tests {
+		DebugErrors = tt.debug
+		m := NewMux()
+		m.SetJSONOnly(tt.jsonOnly)
+		m.Get("/", func(w http.ResponseWriter, req *http.Request) error {
+			return tt.err
+		})
+		w := testServe(m, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Body.String() != tt.body {
+			t.Errorf("TestDefaultErrorHandlerDebugErrors %s: body %q, expected %q", name, w.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	allowed := map[string]string{"name": "users.name", "created": "users.created_at"}
+	tests := map[string]struct {
+		query string
+		want  []SortField
+		err   error
+	}{
+		"none":       {"", []SortField{}, nil},
+		"ascending":  {"sort=name", []SortField{{"users.name", false}}, nil},
+		"descending": {"sort=-created", []SortField{{"users.created_at", true}}, nil},
+		"plus":       {"sort=%2Bname", []SortField{{"users.name", false}}, nil},
+		"multiple":   {"sort=name,-created", []SortField{{"users.name", false}, {"users.created_at", true}}, nil},
+		"repeated":   {"sort=name&sort=-created", []SortField{{"users.name", false}, {"users.created_at", true}}, nil},
+		"disallowed": {"sort=name,password", nil, ErrInvalidSort},
+		"column":     {"sort=users.name", nil, ErrInvalidSort},
+		"injection":  {"sort=name%3BDROP%20TABLE%20users", nil, ErrInvalidSort},
+		"duplicate":  {"sort=name,-name", nil, ErrInvalidSort},
+		"hyphens":    {"sort=--name", nil, ErrInvalidSort},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+		have, err := ParseSort(req, "sort", allowed)
+		if !errors.Is(err, tt.err) || (err == nil) != (tt.err == nil) {
+			t.Errorf("TestParseSort %s: error %v, expected %v", name, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("TestParseSort %s: %v, expected %v", name, have, tt.want)
+		}
+	}
+	if statusCode(ErrInvalidSort) != http.StatusBadRequest {
+		t.Errorf("TestParseSort: status %d", statusCode(ErrInvalidSort))
+	}
+}
+
+func TestMuxRedirectTrailingSlash(t *testing.T) {
+	h := func(w http.ResponseWriter, req *http.Request) error {
+		return nil
+	}
+	m := NewMux()
+	m.SetRedirectTrailingSlash(true)
+	m.Get("/users", h)
+	m.Post("/users", h)
+	m.Get("/dirs/", h)
+	sub := m.NewSubMux("/api/*")
+	sub.Get("/items", h)
+	tests := map[string]struct {
+		method   string
+		path     string
+		code     int
+		location string
+	}{
+		"strip":          {http.MethodGet, "/users/", http.StatusMovedPermanently, "/users"},
+		"strip head":     {http.MethodHead, "/users/", http.StatusMovedPermanently, "/users"},
+		"strip post":     {http.MethodPost, "/users/", http.StatusPermanentRedirect, "/users"},
+		"add":            {http.MethodGet, "/dirs", http.StatusMovedPermanently, "/dirs/"},
+		"query":          {http.MethodGet, "/users/?page=2", http.StatusMovedPermanently, "/users?page=2"},
+		"sub-mux":        {http.MethodGet, "/api/items/", http.StatusMovedPermanently, "/api/items"},
+		"matched":        {http.MethodGet, "/users", http.StatusOK, ""},
+		"not found":      {http.MethodGet, "/missing/", http.StatusNotFound, ""},
+		"method":         {http.MethodDelete, "/users", http.StatusMethodNotAllowed, ""},
+		"method toggled": {http.MethodDelete, "/users/", http.StatusPermanentRedirect, "/users"},
+		"protocol":       {http.MethodGet, "//users/", http.StatusNotFound, ""},
+	}
+	for name, tt := range tests {
+		w := testServe(m, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("TestMuxRedirectTrailingSlash %s: status %d, expected %d", name, w.Code, tt.code)
+		}
+		if v := w.Header().Get("Location"); v != tt.location {
+			t.Errorf("TestMuxRedirectTrailingSlash %s: location %q, expected %q", name, v, tt.location)
+		}
+	}
+	m.SetRedirectTrailingSlash(false)
+	w := testServe(m, httptest.NewRequest(http.MethodGet, "/users/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("TestMuxRedirectTrailingSlash disabled: status %d, expected %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,244 @@
+package httpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// ApplyMergePatch applies the request body as a JSON merge patch as
+// defined by RFC 7396 to the value pointed to by original, such as the
+// current state of a resource for a PATCH request. Object members of
+// the patch replace the matching fields of original, nested objects are
+// merged recursively and all other values, including arrays, replace the
+// field as a whole. A null member deletes the field by setting it to its
+// zero value if it is a pointer, map, slice or interface, and removes
+// the key of maps. Null members of other fields are ignored, so fields
+// that may be deleted should be pointers. Members without a matching
+// field are ignored, or rejected with ErrUnknownField if
+// DisallowUnknownFields is enabled.
+//
+// The request body is limited to DefaultMaxBodySize, or the MaxBodySize
+// of an original implementing BodySizeForm, and ErrBodyTooLarge is
+// returned if it is exceeded. If original implements Form, it is
+// validated after the patch is applied.
+func ApplyMergePatch(original interface{}, req *http.Request) error {
+	v := reflect.ValueOf(original)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.New("httpc: merge patch original must be a non-nil pointer")
+	}
+	defer req.Body.Close()
+	n := DefaultMaxBodySize
+	bf, ok := original.(BodySizeForm)
+	if ok {
+		n = bf.MaxBodySize()
+	}
+	b, err := io.ReadAll(http.MaxBytesReader(nil, req.Body, n))
+	if err != nil {
+		return bodyError(err)
+	}
+	var patch json.RawMessage
+	err = decodeJSON(bytes.NewReader(b), &patch)
+	if err != nil {
+		return err
+	}
+	if !isJSONObject(patch) {
+		return ErrInvalidPatch
+	}
+	err = mergePatch(v.Elem(), patch)
+	if err != nil {
+		return err
+	}
+	form, ok := original.(Form)
+	if ok {
+		return validate(form)
+	}
+	return nil
+}
+
+// mergePatch applies the merge patch to the addressable value v.
+func mergePatch(v reflect.Value, patch json.RawMessage) error {
+	if isJSONNull(patch) {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+	if !isJSONObject(patch) || reflect.PtrTo(v.Type()).Implements(unmarshalerType) {
+		return replacePatch(v, patch)
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return mergePatch(v.Elem(), patch)
+	case reflect.Interface:
+		m, ok := v.Interface().(map[string]interface{})
+		if !ok || v.NumMethod() > 0 {
+			return replacePatch(v, patch)
+		}
+		mv := reflect.ValueOf(&m).Elem()
+		err := mergePatch(mv, patch)
+		if err != nil {
+			return err
+		}
+		v.Set(mv)
+		return nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return replacePatch(v, patch)
+		}
+		return mergeMap(v, patch)
+	case reflect.Struct:
+		return mergeStruct(v, patch)
+	}
+	return replacePatch(v, patch)
+}
+
+// mergeMap applies the merge patch object to the map v.
+func mergeMap(v reflect.Value, patch json.RawMessage) error {
+	var members map[string]json.RawMessage
+	err := json.Unmarshal(patch, &members)
+	if err != nil {
+		return err
+	}
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(v.Type(), len(members)))
+	}
+	t := v.Type()
+	for name, member := range members {
+		k := reflect.ValueOf(name).Convert(t.Key())
+		if isJSONNull(member) {
+			v.SetMapIndex(k, reflect.Value{})
+			continue
+		}
+		elem := reflect.New(t.Elem()).Elem()
+		old := v.MapIndex(k)
+		if old.IsValid() {
+			elem.Set(old)
+		}
+		err = mergePatch(elem, member)
+		if err != nil {
+			return err
+		}
+		v.SetMapIndex(k, elem)
+	}
+	return nil
+}
+
+// mergeStruct applies the merge patch object to the struct v.
+func mergeStruct(v reflect.Value, patch json.RawMessage) error {
+	var members map[string]json.RawMessage
+	err := json.Unmarshal(patch, &members)
+	if err != nil {
+		return err
+	}
+	for name, member := range members {
+		index, ok := jsonField(v.Type(), name)
+		if !ok {
+			if DisallowUnknownFields {
+				return fmt.Errorf("%w: %q", ErrUnknownField, name)
+			}
+			continue
+		}
+		f, ok := fieldByIndex(v, index, !isJSONNull(member))
+		if !ok {
+			continue
+		}
+		err = mergePatch(f, member)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replacePatch replaces v with the JSON value of patch.
+func replacePatch(v reflect.Value, patch json.RawMessage) error {
+	p := reflect.New(v.Type())
+	err := json.Unmarshal(patch, p.Interface())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	v.Set(p.Elem())
+	return nil
+}
+
+// jsonField returns the index of the field of the struct type t that
+// encoding/json decodes the object member name into. Fields of embedded
+// structs are promoted and names are matched case-insensitively if
+// there is no exact match.
+func jsonField(t reflect.Type, name string) ([]int, bool) {
+	var fold []int
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		tagName, _, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && tagName == "" && ft.Kind() == reflect.Struct {
+			index, ok := jsonField(ft, name)
+			if ok {
+				return append([]int{i}, index...), true
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		fieldName := f.Name
+		if tagName != "" {
+			fieldName = tagName
+		}
+		if fieldName == name {
+			return []int{i}, true
+		}
+		if fold == nil && strings.EqualFold(fieldName, name) {
+			fold = []int{i}
+		}
+	}
+	return fold, fold != nil
+}
+
+// fieldByIndex returns the nested field of the struct v by index. Nil
+// embedded struct pointers are allocated if alloc is true, otherwise
+// false is returned if the field is unreachable. Embedded pointers to
+// unexported struct types can not be allocated.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc || !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, v.CanSet()
+}
+
+// isJSONNull reports whether b is the JSON null literal.
+func isJSONNull(b json.RawMessage) bool {
+	return string(bytes.TrimSpace(b)) == "null"
+}
+
+// isJSONObject reports whether b is a JSON object.
+func isJSONObject(b json.RawMessage) bool {
+	b = bytes.TrimSpace(b)
+	return len(b) > 0 && b[0] == '{'
+}
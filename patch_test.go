@@ -0,0 +1,131 @@
+package httpc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testPatchAddress struct {
+	City    string  `json:"city"`
+	Country string  `json:"country"`
+	Unit    *string `json:"unit"`
+}
+
+type testPatchMeta struct {
+	Version int `json:"version"`
+}
+
+type testPatch struct {
+	testPatchMeta
+	Name     string                 `json:"name"`
+	Nickname *string                `json:"nickname"`
+	Age      int                    `json:"age"`
+	Tags     []string               `json:"tags"`
+	Address  *testPatchAddress      `json:"address"`
+	Labels   map[string]string      `json:"labels"`
+	Extra    map[string]interface{} `json:"extra"`
+	Secret   string                 `json:"-"`
+	internal string
+}
+
+type testPatchForm struct {
+	Name string `json:"name"`
+}
+
+func (f *testPatchForm) Validate() error {
+	if f.Name == "" {
+		return errors.New("name required")
+	}
+	return nil
+}
+
+func (f *testPatchForm) MaxBodySize() int64 {
+	return 32
+}
+
+func testPatchString(s string) *string {
+	return &s
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	original := func() testPatch {
+		return testPatch{
+			testPatchMeta: testPatchMeta{Version: 1},
+			Name:          "alice",
+			Nickname:      testPatchString("al"),
+			Age:           30,
+			Tags:          []string{"a", "b"},
+			Address:       &testPatchAddress{City: "Paris", Country: "FR", Unit: testPatchString("4B")},
+			Labels:        map[string]string{"team": "core", "role": "dev"},
+			Extra:         map[string]interface{}{"a": map[string]interface{}{"b": 1.0, "c": 2.0}},
+			Secret:        "hash",
+			internal:      "x",
+		}
+	}
+	tests := map[string]struct {
+		patch string
+		want  func(*testPatch)
+		err   error
+	}{
+		"empty":        {`{}`, func(p *testPatch) {}, nil},
+		"update":       {`{"name":"bob","age":31}`, func(p *testPatch) { p.Name = "bob"; p.Age = 31 }, nil},
+		"fold":         {`{"NAME":"bob"}`, func(p *testPatch) { p.Name = "bob" }, nil},
+		"embedded":     {`{"version":2}`, func(p *testPatch) { p.Version = 2 }, nil},
+		"null pointer": {`{"nickname":null}`, func(p *testPatch) { p.Nickname = nil }, nil},
+		"null value":   {`{"age":null}`, func(p *testPatch) {}, nil},
+		"null struct":  {`{"address":null}`, func(p *testPatch) { p.Address = nil }, nil},
+		"array":        {`{"tags":["c"]}`, func(p *testPatch) { p.Tags = []string{"c"} }, nil},
+		"nested":       {`{"address":{"city":"Lyon"}}`, func(p *testPatch) { p.Address.City = "Lyon" }, nil},
+		"nested null":  {`{"address":{"unit":null}}`, func(p *testPatch) { p.Address.Unit = nil }, nil},
+		"map":          {`{"labels":{"role":null,"env":"prod"}}`, func(p *testPatch) { p.Labels = map[string]string{"team": "core", "env": "prod"} }, nil},
+		"map nested":   {`{"extra":{"a":{"b":null,"d":3}}}`, func(p *testPatch) { p.Extra = map[string]interface{}{"a": map[string]interface{}{"c": 2.0, "d": 3.0}} }, nil},
+		"ignored":      {`{"Secret":"x","internal":"y","unknown":1}`, func(p *testPatch) {}, nil},
+		"not object":   {`["name"]`, nil, ErrInvalidPatch},
+		"wrong type":   {`{"age":"old"}`, nil, ErrInvalidPatch},
+		"trailing":     {`{} {}`, nil, ErrTrailingData},
+	}
+	for name, tt := range tests {
+		got := original()
+		req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(tt.patch))
+		err := ApplyMergePatch(&got, req)
+		if !errors.Is(err, tt.err) || (err == nil) != (tt.err == nil) {
+			t.Errorf("TestApplyMergePatch %s: error %v, expected %v", name, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		want := original()
+		tt.want(&want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("TestApplyMergePatch %s:\n%+v\nexpected\n%+v", name, got, want)
+		}
+	}
+}
+
+func TestApplyMergePatchForm(t *testing.T) {
+	defer func(v bool) { DisallowUnknownFields = v }(DisallowUnknownFields)
+	tests := map[string]struct {
+		patch    string
+		disallow bool
+		err      error
+	}{
+		"valid":     {`{"name":"bob"}`, false, nil},
+		"invalid":   {`{"name":""}`, false, errors.New("name required")},
+		"too large": {`{"name":"` + strings.Repeat("a", 32) + `"}`, false, ErrBodyTooLarge},
+		"unknown":   {`{"nick":"bob"}`, true, ErrUnknownField},
+	}
+	for name, tt := range tests {
+		DisallowUnknownFields = tt.disallow
+		form := &testPatchForm{Name: "alice"}
+		req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(tt.patch))
+		err := ApplyMergePatch(form, req)
+		if (err == nil) != (tt.err == nil) || err != nil && !errors.Is(err, tt.err) && err.Error() != tt.err.Error() {
+			t.Errorf("TestApplyMergePatchForm %s: error %v, expected %v", name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package httpc
+
+import (
+	"net/http"
+	"sort"
+)
+
+// Problem represents an RFC 7807 problem details object.
+type Problem struct {
+	Type          string         `json:"type,omitempty"`
+	Title         string         `json:"title,omitempty"`
+	Status        int            `json:"status,omitempty"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	InvalidParams []InvalidParam `json:"invalid-params,omitempty"`
+}
+
+// InvalidParam represents an entry of the invalid-params
+// problem extension for field level validation errors.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// NewProblem returns a new problem for the HTTP status code.
+func NewProblem(code int) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(code),
+		Status: code,
+	}
+}
+
+// SetInvalidParams sets the invalid-params extension from
+// a map of field names to validation errors. The params are
+// sorted by name so the output is stable.
+func (p *Problem) SetInvalidParams(fields map[string]error) {
+	p.InvalidParams = make([]InvalidParam, 0, len(fields))
+	for name, err := range fields {
+		p.InvalidParams = append(p.InvalidParams, InvalidParam{Name: name, Reason: err.Error()})
+	}
+	sort.Slice(p.InvalidParams, func(i, j int) bool {
+		return p.InvalidParams[i].Name < p.InvalidParams[j].Name
+	})
+}
+
+// NewValidationProblem returns a new problem for the validation error
+// with the invalid-params extension set from its field errors.
+func NewValidationProblem(e *ValidationError) *Problem {
+	p := NewProblem(e.StatusCode())
+	p.SetInvalidParams(e.Fields)
+	return p
+}
+
+// RenderProblem writes the problem as application/problem+json.
+// A zero Status is written as http.StatusInternalServerError.
+func RenderProblem(w http.ResponseWriter, p *Problem) error {
+	if p.Status == 0 {
+		q := *p
+		q.Status = http.StatusInternalServerError
+		p = &q
+	}
+	b, err := Marshal(p)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", contentType(w, "application/problem+json"))
+	w.WriteHeader(p.Status)
+	_, err = w.Write(b)
+	return writeError(err)
+}
@@ -0,0 +1,69 @@
+package httpc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRenderProblem(t *testing.T) {
+	p := NewProblem(http.StatusUnprocessableEntity)
+	p.SetInvalidParams(map[string]error{
+		"name": errors.New("must not be empty"),
+		"age":  errors.New("must be a positive integer"),
+	})
+	w := httptest.NewRecorder()
+	err := RenderProblem(w, p)
+	if err != nil {
+		t.Fatalf("TestRenderProblem: %v", err)
+	}
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("TestRenderProblem: status %d", w.Code)
+	}
+	if v := w.Header().Get("Content-Type"); v != "application/problem+json; charset=utf-8" {
+		t.Errorf("TestRenderProblem: Content-Type %q", v)
+	}
+	want := `{"type":"about:blank","title":"Unprocessable Entity","status":422,"invalid-params":[{"name":"age","reason":"must be a positive integer"},{"name":"name","reason":"must not be empty"}]}`
+	if w.Body.String() != want {
+		t.Errorf("TestRenderProblem: body\n%s\nexpected\n%s", w.Body.String(), want)
+	}
+}
+
+func TestRenderProblemZeroStatus(t *testing.T) {
+	p := &Problem{Title: "Oops"}
+	w := httptest.NewRecorder()
+	err := RenderProblem(w, p)
+	if err != nil {
+		t.Fatalf("TestRenderProblemZeroStatus: %v", err)
+	}
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("TestRenderProblemZeroStatus: status %d, expected %d", w.Code, http.StatusInternalServerError)
+	}
+	want := `{"title":"Oops","status":500}`
+	if w.Body.String() != want {
+		t.Errorf("TestRenderProblemZeroStatus: body %s, expected %s", w.Body.String(), want)
+	}
+	if p.Status != 0 {
+		t.Errorf("TestRenderProblemZeroStatus: problem was modified")
+	}
+}
+
+func TestNewValidationProblem(t *testing.T) {
+	p := NewValidationProblem(&ValidationError{Fields: map[string]error{
+		"name": errors.New("must not be empty"),
+		"age":  errors.New("must be a positive integer"),
+	}})
+	w := httptest.NewRecorder()
+	err := RenderProblem(w, p)
+	if err != nil {
+		t.Fatalf("TestNewValidationProblem: %v", err)
+	}
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("TestNewValidationProblem: status %d", w.Code)
+	}
+	want := `{"type":"about:blank","title":"Unprocessable Entity","status":422,"invalid-params":[{"name":"age","reason":"must be a positive integer"},{"name":"name","reason":"must not be empty"}]}`
+	if w.Body.String() != want {
+		t.Errorf("TestNewValidationProblem: body\n%s\nexpected\n%s", w.Body.String(), want)
+	}
+}
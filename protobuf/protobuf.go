@@ -0,0 +1,76 @@
+// Package protobuf registers protocol buffers with httpc.
+//
+// Import the package for its side effect to render proto.Message views
+// negotiated by httpc.Render as application/x-protobuf and to decode
+// application/x-protobuf request bodies with httpc.Validate:
+//
+//	import _ "github.com/pnelson/httpc/protobuf"
+package protobuf
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/pnelson/httpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// MediaType is the media type of protocol buffers.
+const MediaType = "application/x-protobuf"
+
+func init() {
+	httpc.RegisterRenderer(MediaType, func(view httpc.Viewable) bool {
+		_, ok := view.(proto.Message)
+		return ok
+	}, func(w http.ResponseWriter, view httpc.Viewable, code int) error {
+		return Render(w, view.(proto.Message), code)
+	})
+	httpc.RegisterDecoder(MediaType, func(req *http.Request, form httpc.Form) error {
+		msg, ok := form.(proto.Message)
+		if !ok {
+			return httpc.ErrUnsupportedMediaType
+		}
+		return Validate(req, msg)
+	})
+}
+
+// Render writes the message as marshalled protocol buffers.
+func Render(w http.ResponseWriter, msg proto.Message, code int) error {
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return httpc.RenderBytes(w, MediaType, b, code)
+}
+
+// Validate decodes the request body as protocol buffers and stores the
+// result in msg. If msg implements httpc.Form, it is sanitized and
+// validated. The request body is limited to httpc.DefaultMaxBodySize, or
+// the MaxBodySize of a message implementing httpc.BodySizeForm, and
+// httpc.ErrBodyTooLarge is returned if it is exceeded.
+func Validate(req *http.Request, msg proto.Message) error {
+	defer req.Body.Close()
+	limit := httpc.DefaultMaxBodySize
+	bf, ok := msg.(httpc.BodySizeForm)
+	if ok {
+		limit = bf.MaxBodySize()
+	}
+	b, err := io.ReadAll(http.MaxBytesReader(nil, req.Body, limit))
+	if err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return httpc.ErrBodyTooLarge
+		}
+		return err
+	}
+	err = proto.Unmarshal(b, msg)
+	if err != nil {
+		return err
+	}
+	form, ok := msg.(httpc.Form)
+	if ok {
+		return httpc.ValidateValue(form)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package protobuf
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pnelson/httpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type testForm struct {
+	*wrapperspb.StringValue
+}
+
+func (f testForm) Validate() error {
+	if f.Value == "" {
+		return errors.New("f.Value is empty")
+	}
+	return nil
+}
+
+type testSizedForm struct {
+	testForm
+}
+
+func (f testSizedForm) MaxBodySize() int64 {
+	return 8
+}
+
+type testJSONForm struct {
+	Name string `json:"name"`
+}
+
+func (f *testJSONForm) Validate() error {
+	return nil
+}
+
+func TestRender(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := Render(w, wrapperspb.String("hello"), http.StatusCreated)
+	if err != nil {
+		t.Fatalf("TestRender: %v", err)
+	}
+	if w.Code != http.StatusCreated {
+		t.Errorf("TestRender: status %d, expected %d", w.Code, http.StatusCreated)
+	}
+	if v := w.Header().Get("Content-Type"); v != MediaType {
+		t.Errorf("TestRender: content type %q", v)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(w.Body.Bytes()))
+	var msg wrapperspb.StringValue
+	err = Validate(req, &msg)
+	if err != nil {
+		t.Fatalf("TestRender: %v", err)
+	}
+	if msg.Value != "hello" {
+		t.Errorf("TestRender: round trip %q, expected %q", msg.Value, "hello")
+	}
+}
+
+func TestRenderNegotiate(t *testing.T) {
+	tests := map[string]struct {
+		accept string
+		view   httpc.Viewable
+		want   string
+	}{
+		"protobuf":       {MediaType, wrapperspb.String("hello"), MediaType},
+		"json preferred": {"application/json, " + MediaType, wrapperspb.String("hello"), "application/json; charset=utf-8"},
+		"not message":    {MediaType + ", application/json;q=0.1", map[string]string{}, "application/json; charset=utf-8"},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", tt.accept)
+		w := httptest.NewRecorder()
+		err := httpc.Render(w, req, tt.view, http.StatusOK)
+		if err != nil {
+			t.Errorf("TestRenderNegotiate %s: %v", name, err)
+			continue
+		}
+		if v := w.Header().Get("Content-Type"); v != tt.want {
+			t.Errorf("TestRenderNegotiate %s: content type %q, expected %q", name, v, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := map[string]struct {
+		value string
+		valid bool
+	}{
+		"valid":   {"hello", true},
+		"invalid": {"", false},
+	}
+	for name, tt := range tests {
+		b, err := proto.Marshal(wrapperspb.String(tt.value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+		req.Header.Set("Content-Type", MediaType)
+		form := testForm{&wrapperspb.StringValue{}}
+		err = httpc.Validate(req, form)
+		if (err == nil) != tt.valid {
+			t.Errorf("TestValidate %s: error %v", name, err)
+			continue
+		}
+		if tt.valid && form.Value != tt.value {
+			t.Errorf("TestValidate %s: %q, expected %q", name, form.Value, tt.value)
+		}
+	}
+	b, err := proto.Marshal(wrapperspb.String(strings.Repeat("a", 16)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+	req.Header.Set("Content-Type", MediaType)
+	err = httpc.Validate(req, testSizedForm{testForm{&wrapperspb.StringValue{}}})
+	if err != httpc.ErrBodyTooLarge {
+		t.Errorf("TestValidate sized: %v, expected %v", err, httpc.ErrBodyTooLarge)
+	}
+	req = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(nil))
+	req.Header.Set("Content-Type", MediaType)
+	err = httpc.Validate(req, &testJSONForm{})
+	if err != httpc.ErrUnsupportedMediaType {
+		t.Errorf("TestValidate not message: %v, expected %v", err, httpc.ErrUnsupportedMediaType)
+	}
+}
@@ -0,0 +1,103 @@
+package httpc
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"sort"
+
+	"goji.io/pattern"
+)
+
+// Recover returns middleware that recovers from panics in downstream
+// handlers. The panic is logged to logger along with the request
+// method, path, matched pattern, bound parameters, remote address and
+// request ID before replying with http.StatusInternalServerError, with
+// the panic and stack in the body if DebugErrors is enabled. If logger
+// is nil, slog.Default is used.
+//
+// The middleware should be registered with Mux.Use so that it runs
+// after routing has been performed and the matched pattern is known.
+func Recover(logger *slog.Logger) func(http.Handler) http.Handler {
+	return RecoverStatus(logger, nil)
+}
+
+// RecoverStatus is like Recover but replies to panics recognized by
+// status with the returned status code instead, such as a recovered
+// ErrForbidden with http.StatusForbidden. Recognized panics are not
+// logged. Panics not recognized by status, or all panics if status is
+// nil, are logged and replied to with http.StatusInternalServerError.
+func RecoverStatus(logger *slog.Logger, status func(recovered interface{}) (int, bool)) func(http.Handler) http.Handler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, req *http.Request) {
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				stack := debug.Stack()
+				pe, ok := v.(*panicError)
+				if ok {
+					v, stack = pe.value, pe.stack
+				}
+				if status != nil {
+					code, ok := status(v)
+					if ok {
+						Abort(w, code)
+						return
+					}
+				}
+				logger.LogAttrs(req.Context(), slog.LevelError, "httpc: panic serving request", panicAttrs(req, v, stack)...)
+				if DebugErrors {
+					msg := fmt.Sprintf("%s\npanic: %v\n\n%s", http.StatusText(http.StatusInternalServerError), v, stack)
+					RenderPlain(w, msg, http.StatusInternalServerError)
+					return
+				}
+				Abort(w, http.StatusInternalServerError)
+			}()
+			h.ServeHTTP(w, req)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// panicAttrs returns the log attributes describing a recovered panic.
+func panicAttrs(req *http.Request, v interface{}, stack []byte) []slog.Attr {
+	var matched string
+	p := Pattern(req)
+	if p != nil {
+		matched = p.String()
+	}
+	return []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("path", req.URL.Path),
+		slog.String("pattern", matched),
+		{Key: "params", Value: paramAttrs(req)},
+		slog.String("remote_addr", RemoteAddr(req)),
+		slog.String("request_id", RequestID(req)),
+		slog.Any("panic", v),
+		slog.String("stack", string(stack)),
+	}
+}
+
+// paramAttrs returns the bound pattern parameters as a log group value.
+func paramAttrs(req *http.Request) slog.Value {
+	vars, _ := req.Context().Value(pattern.AllVariables).(map[pattern.Variable]interface{})
+	names := make([]string, 0, len(vars))
+	for k := range vars {
+		names = append(names, string(k))
+	}
+	sort.Strings(names)
+	attrs := make([]slog.Attr, len(names))
+	for i, name := range names {
+		attrs[i] = slog.Any(name, vars[pattern.Variable(name)])
+	}
+	return slog.GroupValue(attrs...)
+}
@@ -0,0 +1,122 @@
+package httpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecover(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	m := NewMux()
+	m.Use(Recover(logger))
+	m.Get("/users/:id", func(w http.ResponseWriter, req *http.Request) error {
+		panic("boom")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Request-ID", "abc123")
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("TestRecover: status %d, expected %d", w.Code, http.StatusInternalServerError)
+	}
+	var record struct {
+		Method     string            `json:"method"`
+		Path       string            `json:"path"`
+		Pattern    string            `json:"pattern"`
+		Params     map[string]string `json:"params"`
+		RemoteAddr string            `json:"remote_addr"`
+		RequestID  string            `json:"request_id"`
+		Panic      string            `json:"panic"`
+		Stack      string            `json:"stack"`
+	}
+	err := json.Unmarshal(buf.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("TestRecover: %v", err)
+	}
+	tests := map[string][2]string{
+		"method":      {record.Method, http.MethodGet},
+		"path":        {record.Path, "/users/42"},
+		"pattern":     {record.Pattern, "/users/:id"},
+		"params":      {record.Params["id"], "42"},
+		"remote_addr": {record.RemoteAddr, "192.0.2.1"},
+		"request_id":  {record.RequestID, "abc123"},
+		"panic":       {record.Panic, "boom"},
+	}
+	for name, tt := range tests {
+		if tt[0] != tt[1] {
+			t.Errorf("TestRecover %s: %q, expected %q", name, tt[0], tt[1])
+		}
+	}
+	if record.Stack == "" {
+		t.Errorf("TestRecover: expected stack")
+	}
+}
+
+func TestRecoverStatus(t *testing.T) {
+	errForbidden := errors.New("forbidden")
+	status := func(v interface{}) (int, bool) {
+		err, ok := v.(error)
+		if ok && errors.Is(err, errForbidden) {
+			return http.StatusForbidden, true
+		}
+		return 0, false
+	}
+	tests := map[string]struct {
+		panic  interface{}
+		code   int
+		logged bool
+	}{
+		"mapped":   {errForbidden, http.StatusForbidden, false},
+		"unmapped": {"boom", http.StatusInternalServerError, true},
+	}
+	for name, tt := range tests {
+		var buf bytes.Buffer
+		m := NewMux()
+		m.Use(RecoverStatus(slog.New(slog.NewJSONHandler(&buf, nil)), status))
+		m.Get("/", func(w http.ResponseWriter, req *http.Request) error {
+			panic(tt.panic)
+		})
+		w := testServe(m, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != tt.code {
+			t.Errorf("TestRecoverStatus %s: status %d, expected %d", name, w.Code, tt.code)
+		}
+		if (buf.Len() > 0) != tt.logged {
+			t.Errorf("TestRecoverStatus %s: logged %t, expected %t", name, buf.Len() > 0, tt.logged)
+		}
+	}
+}
+
+func TestRecoverDebugErrors(t *testing.T) {
+	defer func(v bool) { DebugErrors = v }(DebugErrors)
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	for _, debug := range []bool{false, true} {
+		DebugErrors = debug
+		m := NewMux()
+		m.Use(Recover(logger))
+		m.Get("/", func(w http.ResponseWriter, req *http.Request) error {
+			panic("boom")
+		})
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("TestRecoverDebugErrors %t: status %d, expected %d", debug, w.Code, http.StatusInternalServerError)
+		}
+		body := w.Body.String()
+		if !strings.HasPrefix(body, "Internal Server Error\n") {
+			t.Errorf("TestRecoverDebugErrors %t: body %q", debug, body)
+		}
+		hasPanic := strings.Contains(body, "panic: boom") && strings.Contains(body, "goroutine ")
+		if hasPanic != debug {
+			t.Errorf("TestRecoverDebugErrors %t: body %q", debug, body)
+		}
+	}
+}
@@ -1,85 +1,707 @@
 package httpc
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"html/template"
+	"io"
 	"mime"
 	"net/http"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 // Viewable represents a view. To provide an expressive API, this
 // type is an alias for interface{} that is named for documentation.
 type Viewable interface{}
 
+// Renderer represents the ability to render HTML templates
+// with the data of the view itself.
+type Renderer interface {
+	Render() ([]byte, error)
+}
+
+// CSVMarshaler represents the ability to render the view as CSV records.
+type CSVMarshaler interface {
+	MarshalCSV() ([][]string, error)
+}
+
 // Renderable represents the ability to render HTML templates.
+// The view is passed to its own Render method.
+//
+// Deprecated: Renderable is superseded by Renderer. To migrate,
+// change the Render method to take no argument and use the
+// receiver as the template data. Views implementing either
+// interface are rendered as HTML.
 type Renderable interface {
 	Render(view interface{}) ([]byte, error)
 }
 
+// renderHTML renders the view as HTML.
+func renderHTML(view Viewable) ([]byte, error) {
+	switch v := view.(type) {
+	case Renderer:
+		return v.Render()
+	case Renderable:
+		return v.Render(v)
+	}
+	return nil, fmt.Errorf("httpc: view for RenderHTML must be a Renderer")
+}
+
+// isRenderable reports whether the view can be rendered as HTML.
+func isRenderable(view Viewable) bool {
+	switch view.(type) {
+	case Renderer, Renderable:
+		return true
+	}
+	return false
+}
+
+// PreferSecFetchDest enables the use of the Sec-Fetch-Dest request
+// header to disambiguate a vague Accept header of */*. When enabled,
+// document navigations are rendered as HTML if the view is a Renderer
+// and all other fetch destinations are rendered as JSON.
+var PreferSecFetchDest bool
+
+// DefaultAccept is the media range used by Render when the request
+// has no Accept header. If empty or if the view cannot be rendered in
+// the default format, the view is rendered as JSON.
+var DefaultAccept string
+
+// ContentLocation optionally returns the Content-Location header value
+// for a response rendered by Render in the negotiated media type, such
+// as a format specific URL. The header is not set if ContentLocation is
+// nil or returns the empty string.
+var ContentLocation func(req *http.Request, media string) string
+
+// CompressRender enables compression of responses written by Render
+// with the content coding negotiated by CompressResponse.
+var CompressRender bool
+
+// contentType returns the media type with the charset=utf-8
+// parameter, unless omitted by the render options of w.
+func contentType(w http.ResponseWriter, media string) string {
+	if renderOptionsOf(w).omitCharset {
+		return media
+	}
+	return media + "; charset=utf-8"
+}
+
+// renderOptions are the per-mux options of the render functions.
+type renderOptions struct {
+	emptyCollections bool
+	omitCharset      bool
+}
+
+// renderWriter is a http.ResponseWriter carrying the
+// render options of the mux serving the request.
+type renderWriter struct {
+	http.ResponseWriter
+	opts renderOptions
+}
+
+// Flush implements the http.Flusher interface.
+func (w *renderWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying http.ResponseWriter.
+func (w *renderWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// withRenderOptions returns w with the render options opts, wrapping
+// it only if they differ from the render options already set on w.
+func withRenderOptions(w http.ResponseWriter, opts renderOptions) http.ResponseWriter {
+	if renderOptionsOf(w) == opts {
+		return w
+	}
+	return &renderWriter{ResponseWriter: w, opts: opts}
+}
+
+// renderOptionsOf returns the render options of the innermost mux
+// serving the response written to w, or the zero options if none.
+func renderOptionsOf(w http.ResponseWriter) renderOptions {
+	for w != nil {
+		switch t := w.(type) {
+		case *renderWriter:
+			return t.opts
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return renderOptions{}
+		}
+	}
+	return renderOptions{}
+}
+
+// A RenderFunc writes the view in a media type.
+type RenderFunc func(w http.ResponseWriter, view Viewable, code int) error
+
+// viewRenderer renders views in a media type that is not built in.
+type viewRenderer struct {
+	media   string
+	accepts func(view Viewable) bool
+	render  RenderFunc
+}
+
+// renderers are the view renderers offered by Render after the built
+// in media types. Media types backed by third party packages are
+// registered by their own packages, such as httpc/protobuf, to keep
+// the dependencies isolated.
+var renderers = struct {
+	sync.RWMutex
+	s []viewRenderer
+}{}
+
+// RegisterRenderer registers the RenderFunc used by Render to write
+// views in the media type. The media type is offered after the built in
+// media types for views that accepts reports true for, in the order the
+// media types are registered. Registering a media type again replaces it.
+func RegisterRenderer(media string, accepts func(view Viewable) bool, fn RenderFunc) {
+	renderers.Lock()
+	defer renderers.Unlock()
+	r := viewRenderer{media: media, accepts: accepts, render: fn}
+	for i := range renderers.s {
+		if renderers.s[i].media == media {
+			renderers.s[i] = r
+			return
+		}
+	}
+	renderers.s = append(renderers.s, r)
+}
+
+// renderer returns the registered RenderFunc of the media type.
+func renderer(media string) (RenderFunc, bool) {
+	renderers.RLock()
+	defer renderers.RUnlock()
+	for _, r := range renderers.s {
+		if r.media == media {
+			return r.render, true
+		}
+	}
+	return nil, false
+}
+
 // Render writes the view in the requested format, if available.
-func Render(w http.ResponseWriter, req *http.Request, view Viewable, code int) error {
-	accept := req.Header.Get("Accept")
-	if accept == "" {
+// The format is negotiated with the quality values of the Accept
+// header as described by RFC 9110. Views are always written as
+// JSON for requests served by a mux in JSON only mode. If
+// CompressRender is enabled, the response is compressed with
+// CompressResponse.
+func Render(w http.ResponseWriter, req *http.Request, view Viewable, code int) (err error) {
+	if CompressRender {
+		cw, done := CompressResponse(w, req)
+		defer func() {
+			cerr := done()
+			if err == nil {
+				err = cerr
+			}
+		}()
+		w = cw
+	}
+	if isJSONOnly(req) {
 		return RenderJSON(w, view, code)
 	}
-	for _, h := range strings.Split(accept, ",") {
-		media, _, err := mime.ParseMediaType(h)
+	media := negotiate(req, view)
+	if media == "" {
+		return Abort(w, http.StatusNotAcceptable)
+	}
+	if ContentLocation != nil {
+		loc := ContentLocation(req, media)
+		if loc != "" {
+			w.Header().Set("Content-Location", loc)
+		}
+	}
+	switch media {
+	case "text/html":
+		return RenderHTML(w, view, code)
+	case "text/plain":
+		return RenderPlain(w, view, code)
+	case "text/csv":
+		records, err := view.(CSVMarshaler).MarshalCSV()
 		if err != nil {
 			return err
 		}
-		switch media {
-		case "text/html", "text/*":
-			v, ok := view.(Renderable)
-			if !ok {
+		return RenderCSV(w, records, code)
+	case "application/xml", "text/xml":
+		return RenderXML(w, view, code)
+	}
+	fn, ok := renderer(media)
+	if ok {
+		return fn(w, view, code)
+	}
+	return RenderJSON(w, view, code)
+}
+
+// negotiate returns the media type to render the view in for the
+// request, or the empty string if no acceptable media type is available.
+func negotiate(req *http.Request, view Viewable) string {
+	accept := req.Header.Get("Accept")
+	defaulted := accept == ""
+	if defaulted {
+		accept = DefaultAccept
+	}
+	if accept == "" {
+		return "application/json"
+	}
+	ranges := parseAccept(accept)
+	media := bestOffer(ranges, offers(req, view, ranges))
+	if media == "" && defaulted {
+		return "application/json"
+	}
+	return media
+}
+
+// offers returns the media types the view can be rendered in, in order
+// of preference when the Accept header does not distinguish them. XML is
+// only offered if the media ranges explicitly accept it, so that wildcards
+// such as text/* do not select XML, and the view can be marshalled as XML.
+func offers(req *http.Request, view Viewable, ranges []mediaRange) []string {
+	var offers []string
+	renderable := isRenderable(view)
+	document := renderable && PreferSecFetchDest && req.Header.Get("Sec-Fetch-Dest") == "document"
+	if document {
+		offers = append(offers, "text/html")
+	}
+	offers = append(offers, "application/json")
+	if renderable && !document {
+		offers = append(offers, "text/html")
+	}
+	if _, ok := view.(string); ok {
+		offers = append(offers, "text/plain")
+	}
+	if _, ok := view.(CSVMarshaler); ok {
+		offers = append(offers, "text/csv")
+	}
+	renderers.RLock()
+	for _, r := range renderers.s {
+		if r.accepts(view) {
+			offers = append(offers, r.media)
+		}
+	}
+	renderers.RUnlock()
+	if !isXMLMarshalable(view) {
+		return offers
+	}
+	for _, media := range []string{"application/xml", "text/xml"} {
+		if acceptsExplicitly(ranges, media) {
+			offers = append(offers, media)
+		}
+	}
+	return offers
+}
+
+// acceptsExplicitly reports whether the media ranges
+// accept the media type without a wildcard.
+func acceptsExplicitly(ranges []mediaRange, media string) bool {
+	for _, r := range ranges {
+		if r.q > 0 && r.specificity() == 2 && r.matches(media) {
+			return true
+		}
+	}
+	return false
+}
+
+// xmlMarshalerType is the reflect.Type of the xml.Marshaler interface.
+var xmlMarshalerType = reflect.TypeOf((*xml.Marshaler)(nil)).Elem()
+
+// isXMLMarshalable reports whether the view can be marshalled as XML.
+func isXMLMarshalable(view Viewable) bool {
+	if view == nil {
+		return true
+	}
+	return xmlMarshalable(reflect.TypeOf(view), make(map[reflect.Type]bool))
+}
+
+// xmlMarshalable reports whether values of type t can be marshalled as
+// XML. Types in seen are assumed to be marshalable to handle recursion.
+func xmlMarshalable(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] || t.Implements(xmlMarshalerType) || reflect.PointerTo(t).Implements(xmlMarshalerType) {
+		return true
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Map, reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return false
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return xmlMarshalable(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() && !f.Anonymous || f.Tag.Get("xml") == "-" {
 				continue
 			}
-			return RenderHTML(w, v, code)
-		case "application/json", "application/*", "*/*":
-			return RenderJSON(w, view, code)
-		case "text/plain":
-			return RenderPlain(w, view, code)
+			if !xmlMarshalable(f.Type, seen) {
+				return false
+			}
 		}
 	}
-	return Abort(w, http.StatusNotAcceptable)
+	return true
+}
+
+// mediaRange represents a media range of the Accept header.
+type mediaRange struct {
+	typ     string
+	subtype string
+	q       float64
+	index   int
+}
+
+// specificity returns 2 for a media type, 1 for a
+// subtype wildcard and 0 for the wildcard media range.
+func (r mediaRange) specificity() int {
+	switch {
+	case r.typ == "*":
+		return 0
+	case r.subtype == "*":
+		return 1
+	}
+	return 2
+}
+
+// matches reports whether the media range includes the media type.
+func (r mediaRange) matches(media string) bool {
+	typ, subtype, _ := strings.Cut(media, "/")
+	return r.typ == "*" || (r.typ == typ && (r.subtype == "*" || r.subtype == subtype))
+}
+
+// parseAccept parses the media ranges of the Accept header value.
+// Malformed media ranges and quality values are ignored.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for i, v := range strings.Split(accept, ",") {
+		media, params, err := mime.ParseMediaType(v)
+		if err != nil {
+			continue
+		}
+		typ, subtype, ok := strings.Cut(media, "/")
+		if !ok || typ == "" || subtype == "" || (typ == "*" && subtype != "*") {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{typ: typ, subtype: subtype, q: q, index: i})
+	}
+	return ranges
+}
+
+// bestOffer returns the offer with the highest quality value, or the
+// empty string if none are acceptable. The quality of an offer is that
+// of the most specific media range that matches it. Ties are broken by
+// specificity, then by the order of the media ranges and the offers.
+func bestOffer(ranges []mediaRange, offers []string) string {
+	var best string
+	var bestRange mediaRange
+	for _, offer := range offers {
+		r, ok := matchOffer(ranges, offer)
+		if !ok || r.q == 0 {
+			continue
+		}
+		if best == "" || r.q > bestRange.q ||
+			(r.q == bestRange.q && r.specificity() > bestRange.specificity()) ||
+			(r.q == bestRange.q && r.specificity() == bestRange.specificity() && r.index < bestRange.index) {
+			best = offer
+			bestRange = r
+		}
+	}
+	return best
+}
+
+// matchOffer returns the most specific media range matching the offer.
+func matchOffer(ranges []mediaRange, offer string) (mediaRange, bool) {
+	var match mediaRange
+	ok := false
+	for _, r := range ranges {
+		if !r.matches(offer) {
+			continue
+		}
+		if !ok || r.specificity() > match.specificity() {
+			match = r
+			ok = true
+		}
+	}
+	return match, ok
 }
 
 // RenderHTML writes the view as templated HTML.
-func RenderHTML(w http.ResponseWriter, view Renderable, code int) error {
-	b, err := view.Render(view)
+// The view must be a Renderer or Renderable.
+func RenderHTML(w http.ResponseWriter, view Viewable, code int) error {
+	b, err := renderHTML(view)
 	if err != nil {
 		return err
 	}
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Type", contentType(w, "text/html"))
 	w.WriteHeader(code)
 	_, err = w.Write(b)
+	return writeError(err)
+}
+
+// EncodeHTML writes the view as templated HTML to w. It renders views
+// the same as RenderHTML for reuse outside of handlers, such as for
+// email bodies.
+func EncodeHTML(w io.Writer, view Viewable) error {
+	b, err := renderHTML(view)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
 	return err
 }
 
+// RenderTemplateSafe executes the HTML template with data into a buffer
+// and writes it only if execution succeeds. On failure nothing is written
+// and the error is returned, so that the error handler can reply with a
+// clean error page rather than a partially rendered one.
+func RenderTemplateSafe(w http.ResponseWriter, tmpl *template.Template, data interface{}, code int) error {
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, data)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", contentType(w, "text/html"))
+	w.WriteHeader(code)
+	_, err = buf.WriteTo(w)
+	return writeError(err)
+}
+
+// ResponseEnvelope optionally wraps the view of successful responses
+// rendered by RenderJSON, such as in {"data": view}. It is applied to
+// non-nil views with a status code below 400. If nil, views are
+// rendered as is.
+var ResponseEnvelope func(view Viewable) Viewable
+
 // RenderJSON writes the view as marshalled JSON.
 func RenderJSON(w http.ResponseWriter, view Viewable, code int) error {
-	b, err := json.Marshal(view)
+	if ResponseEnvelope != nil && view != nil && code < http.StatusBadRequest {
+		view = ResponseEnvelope(view)
+	}
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	err := encodeJSON(buf, view, renderOptionsOf(w))
 	if err != nil {
 		return err
 	}
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	defer putBuffer(buf)
+	w.Header().Set("Content-Type", contentType(w, "application/json"))
 	w.WriteHeader(code)
 	if view == nil {
 		return nil
 	}
+	_, err = w.Write(buf.Bytes())
+	return writeError(err)
+}
+
+// bufferPool pools the buffers used to encode JSON responses.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// maxPooledBufferSize is the capacity above which buffers are not
+// returned to bufferPool so that large responses are not retained.
+const maxPooledBufferSize = 64 << 10
+
+// putBuffer returns buf to bufferPool.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// encodeJSON writes the view marshalled as JSON the same as MarshalJSON
+// to buf. Unless Marshal was replaced, the view is encoded with a
+// json.Encoder writing to buf directly to avoid allocating a copy of the
+// encoding.
+func encodeJSON(buf *bytes.Buffer, view Viewable, opts renderOptions) error {
+	view = jsonView(view, opts)
+	if !isStdMarshal() {
+		b, err := Marshal(view)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		return nil
+	}
+	err := json.NewEncoder(buf).Encode(view)
+	if err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1) // trailing newline
+	return nil
+}
+
+// StreamJSON writes the view as JSON the same as RenderJSON, except that
+// the view is encoded to w with a json.Encoder, which reuses its encoding
+// buffers rather than allocating a copy of the body for every response,
+// and is followed by a newline. Marshal is not used. The headers are
+// written and flushed before encoding, so the status code can not be
+// changed if encoding fails and the client receives an empty or truncated
+// body. The error handler should not attempt to reply in that case.
+func StreamJSON(w http.ResponseWriter, view Viewable, code int) error {
+	if ResponseEnvelope != nil && view != nil && code < http.StatusBadRequest {
+		view = ResponseEnvelope(view)
+	}
+	w.Header().Set("Content-Type", contentType(w, "application/json"))
+	w.WriteHeader(code)
+	if view == nil {
+		return nil
+	}
+	http.NewResponseController(w).Flush()
+	return writeError(json.NewEncoder(w).Encode(jsonView(view, renderOptionsOf(w))))
+}
+
+// RenderWithETag writes the view as marshalled JSON the same as RenderJSON
+// with a strong ETag computed from the hash of the body. If the status code
+// is successful and the If-None-Match header of the request matches the
+// ETag with the weak comparison of RFC 9110, the response is replaced by
+// http.StatusNotModified for GET and HEAD requests, or by
+// http.StatusPreconditionFailed for other methods, without a body.
+func RenderWithETag(w http.ResponseWriter, req *http.Request, view Viewable, code int) error {
+	if ResponseEnvelope != nil && view != nil && code < http.StatusBadRequest {
+		view = ResponseEnvelope(view)
+	}
+	b, err := Marshal(jsonView(view, renderOptionsOf(w)))
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(b)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	w.Header().Set("ETag", etag)
+	if code >= 200 && code < 300 && matchETag(req.Header.Values("If-None-Match"), etag) {
+		if req.Method == http.MethodGet || req.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return nil
+	}
+	w.Header().Set("Content-Type", contentType(w, "application/json"))
+	w.WriteHeader(code)
+	_, err = w.Write(b)
+	return writeError(err)
+}
+
+// matchETag reports whether the If-None-Match header values match etag
+// with the weak comparison, ignoring the weakness indicators.
+func matchETag(values []string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, v := range values {
+		for v != "" {
+			v = strings.TrimLeft(v, " \t,")
+			if v == "" {
+				break
+			}
+			if v[0] == '*' {
+				return true
+			}
+			v = strings.TrimPrefix(v, "W/")
+			if v == "" || v[0] != '"' {
+				break
+			}
+			i := strings.IndexByte(v[1:], '"')
+			if i < 0 {
+				break
+			}
+			if v[:i+2] == etag {
+				return true
+			}
+			v = v[i+2:]
+		}
+	}
+	return false
+}
+
+// MarshalJSON returns the view marshalled as JSON the same as RenderJSON,
+// except that ResponseEnvelope and the render options of the mux, such as
+// SetEmptyCollections, are not applied, for reuse outside of handlers,
+// such as for generating files.
+func MarshalJSON(view Viewable) ([]byte, error) {
+	return Marshal(jsonView(view, renderOptions{}))
+}
+
+// jsonView returns the view with the render options applied for marshalling.
+func jsonView(view Viewable, opts renderOptions) Viewable {
+	if opts.emptyCollections && view != nil {
+		view = emptyCollections(reflect.ValueOf(view), 0).Interface()
+	}
+	return view
+}
+
+// EncodeJSON writes the view as marshalled JSON to w.
+// See MarshalJSON.
+func EncodeJSON(w io.Writer, view Viewable) error {
+	b, err := MarshalJSON(view)
+	if err != nil {
+		return err
+	}
 	_, err = w.Write(b)
 	return err
 }
 
+// RenderXML writes the view as marshalled XML with the XML declaration.
+func RenderXML(w http.ResponseWriter, view Viewable, code int) error {
+	b, err := xml.Marshal(view)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", contentType(w, "application/xml"))
+	w.WriteHeader(code)
+	if view == nil {
+		return nil
+	}
+	_, err = io.WriteString(w, xml.Header)
+	if err != nil {
+		return writeError(err)
+	}
+	_, err = w.Write(b)
+	return writeError(err)
+}
+
+// RenderCSV writes the records as CSV. If a filename is provided, the
+// response is marked as an attachment to download with the filename.
+func RenderCSV(w http.ResponseWriter, records [][]string, code int, filename ...string) error {
+	if len(filename) > 0 && filename[0] != "" {
+		disposition(w, "attachment", filename[0], "")
+	}
+	w.Header().Set("Content-Type", contentType(w, "text/csv"))
+	w.WriteHeader(code)
+	return writeError(csv.NewWriter(w).WriteAll(records))
+}
+
+// RenderBytes writes b as is with the Content-Type contentType,
+// such as for RenderFunc implementations registered with
+// RegisterRenderer.
+func RenderBytes(w http.ResponseWriter, contentType string, b []byte, code int) error {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	_, err := w.Write(b)
+	return writeError(err)
+}
+
 // RenderPlain writes the view as a string.
 func RenderPlain(w http.ResponseWriter, view Viewable, code int) error {
 	s, ok := view.(string)
 	if !ok {
 		return fmt.Errorf("httpc: view for RenderPlain must be a string")
 	}
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Type", contentType(w, "text/plain"))
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 	w.WriteHeader(code)
 	_, err := fmt.Fprintln(w, s)
-	return err
+	return writeError(err)
 }
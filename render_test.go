@@ -0,0 +1,775 @@
+package httpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testView struct {
+	Name string `json:"name"`
+}
+
+func (v testView) Render(view interface{}) ([]byte, error) {
+	return []byte("<p>" + v.Name + "</p>"), nil
+}
+
+type testRendererView struct {
+	Name string `json:"name"`
+}
+
+var testRendererTemplate = template.Must(template.New("").Parse(`<p>{{.Name}}</p>`))
+
+func (v testRendererView) Render() ([]byte, error) {
+	var buf bytes.Buffer
+	err := testRendererTemplate.Execute(&buf, v)
+	return buf.Bytes(), err
+}
+
+func TestRenderHTMLRenderer(t *testing.T) {
+	tests := map[string]struct {
+		view Viewable
+		want string
+	}{
+		"renderer":   {testRendererView{Name: "<foo>"}, "<p>&lt;foo&gt;</p>"},
+		"renderable": {testView{Name: "foo"}, "<p>foo</p>"},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", "text/html")
+		w := httptest.NewRecorder()
+		err := Render(w, req, tt.view, http.StatusOK)
+		if err != nil {
+			t.Errorf("TestRenderHTMLRenderer %s: %v", name, err)
+			continue
+		}
+		if v := w.Header().Get("Content-Type"); v != "text/html; charset=utf-8" {
+			t.Errorf("TestRenderHTMLRenderer %s: Content-Type %q", name, v)
+		}
+		if w.Body.String() != tt.want {
+			t.Errorf("TestRenderHTMLRenderer %s: body %q, expected %q", name, w.Body.String(), tt.want)
+		}
+	}
+	err := RenderHTML(httptest.NewRecorder(), map[string]string{}, http.StatusOK)
+	if err == nil {
+		t.Errorf("TestRenderHTMLRenderer: expected error for view that is not a Renderer")
+	}
+}
+
+func TestRenderSecFetchDest(t *testing.T) {
+	defer func(v bool) { PreferSecFetchDest = v }(PreferSecFetchDest)
+	tests := map[string]struct {
+		dest    string
+		enabled bool
+		want    string
+	}{
+		"document":          {"document", true, "text/html; charset=utf-8"},
+		"empty":             {"empty", true, "application/json; charset=utf-8"},
+		"image":             {"image", true, "application/json; charset=utf-8"},
+		"absent":            {"", true, "application/json; charset=utf-8"},
+		"document disabled": {"document", false, "application/json; charset=utf-8"},
+	}
+	for name, tt := range tests {
+		PreferSecFetchDest = tt.enabled
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", "*/*")
+		if tt.dest != "" {
+			req.Header.Set("Sec-Fetch-Dest", tt.dest)
+		}
+		w := httptest.NewRecorder()
+		err := Render(w, req, testView{Name: "foo"}, http.StatusOK)
+		if err != nil {
+			t.Errorf("TestRenderSecFetchDest %s: %v", name, err)
+			continue
+		}
+		if v := w.Header().Get("Content-Type"); v != tt.want {
+			t.Errorf("TestRenderSecFetchDest %s: Content-Type %q, expected %q", name, v, tt.want)
+		}
+	}
+}
+
+func TestRenderAccept(t *testing.T) {
+	tests := map[string]struct {
+		accept string
+		view   Viewable
+		want   string
+	}{
+		"first":                {"text/html, application/json", testView{}, "text/html"},
+		"first json":           {"application/json, text/html", testView{}, "application/json"},
+		"q order":              {"text/html;q=0.8, application/json;q=0.9", testView{}, "application/json"},
+		"q html":               {"text/html;q=0.9, application/json;q=0.8", testView{}, "text/html"},
+		"q default":            {"text/html;q=0.9, application/json", testView{}, "application/json"},
+		"q exclusion":          {"application/json;q=0, */*", testView{}, "text/html"},
+		"q exclusion all":      {"application/json;q=0", testView{}, ""},
+		"q exclusion wildcard": {"*/*;q=0", testView{}, ""},
+		"q malformed":          {"text/html;q=abc, application/json;q=0.5", testView{}, "application/json"},
+		"q out of range":       {"text/html;q=2, application/json;q=0.5", testView{}, "application/json"},
+		"q negative":           {"text/html;q=-1, application/json;q=0.5", testView{}, "application/json"},
+		"malformed range":      {"text, application/json", testView{}, "application/json"},
+		"malformed wildcard":   {"*/html, application/json", testView{}, "application/json"},
+		"specific over type":   {"text/*, text/html", testView{}, "text/html"},
+		"specific over any":    {"*/*, text/html", testView{}, "text/html"},
+		"type over any":        {"*/*, text/*", testView{}, "text/html"},
+		"specific q wins":      {"text/html;q=0.1, text/*;q=1, application/json;q=0.5", testView{}, "application/json"},
+		"any":                  {"*/*", testView{}, "application/json"},
+		"type wildcard":        {"application/*", testView{}, "application/json"},
+		"not renderable":       {"text/html, application/json;q=0.1", map[string]string{}, "application/json"},
+		"plain string":         {"text/plain, application/json", "foo", "text/plain"},
+		"plain not string":     {"text/plain", testView{}, ""},
+		"xml":                  {"application/xml", testView{}, "application/xml"},
+		"text xml":             {"text/xml, application/json;q=0.5", testView{}, "text/xml"},
+		"xml wildcard":         {"text/*", []string{"foo"}, ""},
+		"xml any":              {"*/*;q=0.5, application/xml", testView{}, "application/xml"},
+		"xml map":              {"application/xml, application/json;q=0.5", map[string]int{}, "application/json"},
+		"xml map wildcard":     {"text/html;q=0.1, text/*;q=1, application/json;q=0.5", map[string]int{}, "application/json"},
+		"xml nested map":       {"application/xml", struct{ M map[string]int }{}, ""},
+		"not acceptable":       {"image/png", testView{}, ""},
+		"csv":                  {"text/csv, application/json;q=0.5", testCSVView{}, "text/csv"},
+		"csv not marshaler":    {"text/csv", testView{}, ""},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", tt.accept)
+		have := negotiate(req, tt.view)
+		if have != tt.want {
+			t.Errorf("TestRenderAccept %s: %q, expected %q", name, have, tt.want)
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "image/png")
+	w := httptest.NewRecorder()
+	Render(w, req, testView{}, http.StatusOK)
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("TestRenderAccept: status %d, expected %d", w.Code, http.StatusNotAcceptable)
+	}
+}
+
+type testCSVView [][]string
+
+func (v testCSVView) MarshalCSV() ([][]string, error) {
+	return v, nil
+}
+
+func TestRenderCSV(t *testing.T) {
+	records := [][]string{
+		{"name", "note"},
+		{"Smith, John", "said \"hi\""},
+		{"Jane", "line one\nline two"},
+	}
+	want := "name,note\n\"Smith, John\",\"said \"\"hi\"\"\"\nJane,\"line one\nline two\"\n"
+	tests := map[string]struct {
+		filename    []string
+		disposition string
+	}{
+		"inline":     {nil, ""},
+		"empty":      {[]string{""}, ""},
+		"attachment": {[]string{"report.csv"}, `attachment; filename=report.csv`},
+	}
+	for name, tt := range tests {
+		w := httptest.NewRecorder()
+		err := RenderCSV(w, records, http.StatusOK, tt.filename...)
+		if err != nil {
+			t.Fatalf("TestRenderCSV %s: %v", name, err)
+		}
+		if v := w.Header().Get("Content-Type"); v != "text/csv; charset=utf-8" {
+			t.Errorf("TestRenderCSV %s: content type %q", name, v)
+		}
+		if v := w.Header().Get("Content-Disposition"); v != tt.disposition {
+			t.Errorf("TestRenderCSV %s: disposition %q, expected %q", name, v, tt.disposition)
+		}
+		if w.Body.String() != want {
+			t.Errorf("TestRenderCSV %s: body\n%q\nexpected\n%q", name, w.Body.String(), want)
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "text/csv")
+	w := httptest.NewRecorder()
+	err := Render(w, req, testCSVView(records), http.StatusOK)
+	if err != nil {
+		t.Fatalf("TestRenderCSV render: %v", err)
+	}
+	if w.Body.String() != want {
+		t.Errorf("TestRenderCSV render: body %q, expected %q", w.Body.String(), want)
+	}
+}
+
+type testErrWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w testErrWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestRenderCSVWriteError(t *testing.T) {
+	err := RenderCSV(testErrWriter{httptest.NewRecorder()}, [][]string{{"a"}}, http.StatusOK)
+	if err == nil {
+		t.Errorf("TestRenderCSVWriteError: expected error")
+	}
+}
+
+func TestRenderWithETag(t *testing.T) {
+	view := map[string]string{"name": "foo"}
+	w := httptest.NewRecorder()
+	err := RenderWithETag(w, httptest.NewRequest(http.MethodGet, "/", nil), view, http.StatusOK)
+	if err != nil {
+		t.Fatalf("TestRenderWithETag: %v", err)
+	}
+	etag := w.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, "W/") {
+		t.Fatalf("TestRenderWithETag: etag %q is not strong", etag)
+	}
+	if w.Body.String() != `{"name":"foo"}` {
+		t.Errorf("TestRenderWithETag: body %q", w.Body.String())
+	}
+	tests := map[string]struct {
+		method      string
+		ifNoneMatch []string
+		code        int
+		status      int
+		body        string
+	}{
+		"none":          {http.MethodGet, nil, http.StatusOK, http.StatusOK, `{"name":"foo"}`},
+		"match":         {http.MethodGet, []string{etag}, http.StatusOK, http.StatusNotModified, ""},
+		"head":          {http.MethodHead, []string{etag}, http.StatusOK, http.StatusNotModified, ""},
+		"weak":          {http.MethodGet, []string{"W/" + etag}, http.StatusOK, http.StatusNotModified, ""},
+		"mismatch":      {http.MethodGet, []string{`"abc"`}, http.StatusOK, http.StatusOK, `{"name":"foo"}`},
+		"multiple":      {http.MethodGet, []string{`"abc", W/"def", ` + etag}, http.StatusOK, http.StatusNotModified, ""},
+		"multiple miss": {http.MethodGet, []string{`"abc", W/"def"`}, http.StatusOK, http.StatusOK, `{"name":"foo"}`},
+		"lines":         {http.MethodGet, []string{`"abc"`, etag}, http.StatusOK, http.StatusNotModified, ""},
+		"any":           {http.MethodGet, []string{"*"}, http.StatusOK, http.StatusNotModified, ""},
+		"unquoted":      {http.MethodGet, []string{strings.Trim(etag, `"`)}, http.StatusOK, http.StatusOK, `{"name":"foo"}`},
+		"put":           {http.MethodPut, []string{"*"}, http.StatusOK, http.StatusPreconditionFailed, ""},
+		"error":         {http.MethodGet, []string{etag}, http.StatusNotFound, http.StatusNotFound, `{"name":"foo"}`},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/", nil)
+		req.Header["If-None-Match"] = tt.ifNoneMatch
+		w := httptest.NewRecorder()
+		err := RenderWithETag(w, req, view, tt.code)
+		if err != nil {
+			t.Errorf("TestRenderWithETag %s: %v", name, err)
+			continue
+		}
+		if w.Code != tt.status {
+			t.Errorf("TestRenderWithETag %s: status %d, expected %d", name, w.Code, tt.status)
+		}
+		if v := w.Header().Get("ETag"); v != etag {
+			t.Errorf("TestRenderWithETag %s: etag %q, expected %q", name, v, etag)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("TestRenderWithETag %s: body %q, expected %q", name, w.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestRenderXML(t *testing.T) {
+	type view struct {
+		XMLName struct{} `xml:"user"`
+		Name    string   `xml:"name"`
+	}
+	tests := map[string]struct {
+		accept string
+		view   Viewable
+		body   string
+	}{
+		"application/xml": {"application/xml", view{Name: "foo"}, xml.Header + "<user><name>foo</name></user>"},
+		"text/xml":        {"text/xml", view{Name: "foo"}, xml.Header + "<user><name>foo</name></user>"},
+		"nil":             {"application/xml", nil, ""},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", tt.accept)
+		w := httptest.NewRecorder()
+		err := Render(w, req, tt.view, http.StatusCreated)
+		if err != nil {
+			t.Errorf("TestRenderXML %s: %v", name, err)
+			continue
+		}
+		if w.Code != http.StatusCreated {
+			t.Errorf("TestRenderXML %s: status %d", name, w.Code)
+		}
+		if v := w.Header().Get("Content-Type"); v != "application/xml; charset=utf-8" {
+			t.Errorf("TestRenderXML %s: Content-Type %q", name, v)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("TestRenderXML %s: body %q, expected %q", name, w.Body.String(), tt.body)
+		}
+	}
+	err := RenderXML(httptest.NewRecorder(), map[string]string{}, http.StatusOK)
+	var e *xml.UnsupportedTypeError
+	if !errors.As(err, &e) {
+		t.Errorf("TestRenderXML: %v, expected *xml.UnsupportedTypeError", err)
+	}
+}
+
+func TestEncodeJSON(t *testing.T) {
+	var buf bytes.Buffer
+	err := EncodeJSON(&buf, struct {
+		Tags []string `json:"tags"`
+	}{})
+	if err != nil {
+		t.Fatalf("TestEncodeJSON: %v", err)
+	}
+	if buf.String() != `{"tags":null}` {
+		t.Errorf("TestEncodeJSON: %q", buf.String())
+	}
+}
+
+func TestEncodeHTML(t *testing.T) {
+	var buf bytes.Buffer
+	err := EncodeHTML(&buf, testView{Name: "foo"})
+	if err != nil {
+		t.Fatalf("TestEncodeHTML: %v", err)
+	}
+	if buf.String() != "<p>foo</p>" {
+		t.Errorf("TestEncodeHTML: %q", buf.String())
+	}
+}
+
+func TestRenderDefaultAccept(t *testing.T) {
+	defer func(v string) { DefaultAccept = v }(DefaultAccept)
+	tests := map[string]struct {
+		accept string
+		view   Viewable
+		want   string
+	}{
+		"unset":          {"", testView{Name: "foo"}, "application/json; charset=utf-8"},
+		"html":           {"text/html", testView{Name: "foo"}, "text/html; charset=utf-8"},
+		"html fallback":  {"text/html", map[string]string{"name": "foo"}, "application/json; charset=utf-8"},
+		"plain fallback": {"text/csv", testView{Name: "foo"}, "application/json; charset=utf-8"},
+	}
+	for name, tt := range tests {
+		DefaultAccept = tt.accept
+		w := httptest.NewRecorder()
+		err := Render(w, httptest.NewRequest(http.MethodGet, "/", nil), tt.view, http.StatusOK)
+		if err != nil {
+			t.Errorf("TestRenderDefaultAccept %s: %v", name, err)
+			continue
+		}
+		if v := w.Header().Get("Content-Type"); v != tt.want {
+			t.Errorf("TestRenderDefaultAccept %s: Content-Type %q, expected %q", name, v, tt.want)
+		}
+	}
+}
+
+func TestRenderContentLocation(t *testing.T) {
+	defer func(fn func(*http.Request, string) string) { ContentLocation = fn }(ContentLocation)
+	ContentLocation = func(req *http.Request, media string) string {
+		if media != "application/json" {
+			return ""
+		}
+		return req.URL.Path + ".json"
+	}
+	tests := map[string]struct {
+		accept string
+		want   string
+	}{
+		"json": {"application/json", "/users/1.json"},
+		"html": {"text/html", ""},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		req.Header.Set("Accept", tt.accept)
+		w := httptest.NewRecorder()
+		err := Render(w, req, testView{Name: "foo"}, http.StatusOK)
+		if err != nil {
+			t.Errorf("TestRenderContentLocation %s: %v", name, err)
+			continue
+		}
+		if v := w.Header().Get("Content-Location"); v != tt.want {
+			t.Errorf("TestRenderContentLocation %s: Content-Location %q, expected %q", name, v, tt.want)
+		}
+	}
+}
+
+func TestRenderJSONEmptyCollections(t *testing.T) {
+	type child struct {
+		Tags []string `json:"tags"`
+	}
+	type view struct {
+		Items    []int             `json:"items"`
+		Meta     map[string]string `json:"meta"`
+		Children []child           `json:"children"`
+		Child    *child            `json:"child"`
+		Nested   map[string][]int  `json:"nested"`
+		Raw      json.RawMessage   `json:"raw,omitempty"`
+		Bytes    []byte            `json:"bytes"`
+		Any      interface{}       `json:"any"`
+		private  []int
+	}
+	v := view{
+		Children: []child{{}},
+		Child:    &child{},
+		Nested:   map[string][]int{"a": nil},
+		Any:      []string(nil),
+	}
+	tests := map[string]struct {
+		enabled bool
+		want    string
+	}{
+		"disabled": {false, `{"items":null,"meta":null,"children":[{"tags":null}],"child":{"tags":null},"nested":{"a":null},"bytes":null,"any":null}`},
+		"enabled":  {true, `{"items":[],"meta":{},"children":[{"tags":[]}],"child":{"tags":[]},"nested":{"a":[]},"bytes":null,"any":[]}`},
+	}
+	for name, tt := range tests {
+		m := NewMux()
+		m.SetEmptyCollections(tt.enabled)
+		m.Get("/", func(w http.ResponseWriter, req *http.Request) error {
+			return RenderJSON(w, v, http.StatusOK)
+		})
+		w := testServe(m, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("TestRenderJSONEmptyCollections %s: status %d", name, w.Code)
+			continue
+		}
+		if w.Body.String() != tt.want {
+			t.Errorf("TestRenderJSONEmptyCollections %s: body\n%s\nexpected\n%s", name, w.Body.String(), tt.want)
+		}
+	}
+	if v.Child.Tags != nil || v.Nested["a"] != nil {
+		t.Errorf("TestRenderJSONEmptyCollections: view was modified")
+	}
+}
+
+func TestMuxSetEmptyCollections(t *testing.T) {
+	type view struct {
+		Tags []string `json:"tags"`
+	}
+	h := func(w http.ResponseWriter, req *http.Request) error {
+		return RenderJSON(w, view{}, http.StatusOK)
+	}
+	m := NewMux()
+	m.SetEmptyCollections(true)
+	m.Get("/", h)
+	m.Get("/buffered", Buffered(h))
+	m.Get("/etag", func(w http.ResponseWriter, req *http.Request) error {
+		return RenderWithETag(w, req, view{}, http.StatusOK)
+	})
+	sub := m.NewSubMux("/legacy/*")
+	sub.SetEmptyCollections(false)
+	sub.Get("/", h)
+	other := NewMux()
+	other.Get("/", h)
+	tests := map[string]struct {
+		h    http.Handler
+		path string
+		want string
+	}{
+		"enabled":  {m, "/", `{"tags":[]}`},
+		"buffered": {m, "/buffered", `{"tags":[]}`},
+		"etag":     {m, "/etag", `{"tags":[]}`},
+		"sub-mux":  {m, "/legacy/", `{"tags":null}`},
+		"other":    {other, "/", `{"tags":null}`},
+	}
+	for name, tt := range tests {
+		w := testServe(tt.h, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Body.String() != tt.want {
+			t.Errorf("TestMuxSetEmptyCollections %s: body %q, expected %q", name, w.Body.String(), tt.want)
+		}
+	}
+}
+
+type testTimeNode struct {
+	At       Time           `json:"at"`
+	Children []testTimeNode `json:"children,omitempty"`
+}
+
+func TestRenderJSONRenderTime(t *testing.T) {
+	defer func(fn func(time.Time) interface{}) { RenderTime = fn }(RenderTime)
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	type view struct {
+		Created  Time            `json:"created"`
+		Deleted  *Time           `json:"deleted"`
+		Times    []Time          `json:"times"`
+		Index    map[string]Time `json:"index"`
+		Standard time.Time       `json:"standard"`
+	}
+	v := view{
+		Created:  Time{at},
+		Times:    []Time{{at}},
+		Index:    map[string]Time{"a": {at}},
+		Standard: at,
+	}
+	node := testTimeNode{At: Time{at}, Children: []testTimeNode{{At: Time{at}}}}
+	unix := func(t time.Time) interface{} { return t.UnixMilli() }
+	tests := map[string]struct {
+		fn   func(time.Time) interface{}
+		view Viewable
+		want string
+	}{
+		"default":    {nil, v, `{"created":"2024-01-02T03:04:05Z","deleted":null,"times":["2024-01-02T03:04:05Z"],"index":{"a":"2024-01-02T03:04:05Z"},"standard":"2024-01-02T03:04:05Z"}`},
+		"unix milli": {unix, v, `{"created":1704164645000,"deleted":null,"times":[1704164645000],"index":{"a":1704164645000},"standard":"2024-01-02T03:04:05Z"}`},
+		"recursive":  {unix, node, `{"at":1704164645000,"children":[{"at":1704164645000}]}`},
+	}
+	for name, tt := range tests {
+		RenderTime = tt.fn
+		w := httptest.NewRecorder()
+		err := RenderJSON(w, tt.view, http.StatusOK)
+		if err != nil {
+			t.Errorf("TestRenderJSONRenderTime %s: %v", name, err)
+			continue
+		}
+		if w.Body.String() != tt.want {
+			t.Errorf("TestRenderJSONRenderTime %s: body\n%s\nexpected\n%s", name, w.Body.String(), tt.want)
+		}
+	}
+}
+
+func TestRenderJSONResponseEnvelope(t *testing.T) {
+	defer func(fn func(Viewable) Viewable) { ResponseEnvelope = fn }(ResponseEnvelope)
+	ResponseEnvelope = func(view Viewable) Viewable {
+		return map[string]interface{}{"data": view, "error": nil}
+	}
+	tests := map[string]struct {
+		view Viewable
+		code int
+		want string
+	}{
+		"success": {testView{Name: "foo"}, http.StatusOK, `{"data":{"name":"foo"},"error":null}`},
+		"error":   {testView{Name: "foo"}, http.StatusBadRequest, `{"name":"foo"}`},
+		"nil":     {nil, http.StatusNoContent, ""},
+	}
+	for name, tt := range tests {
+		w := httptest.NewRecorder()
+		err := RenderJSON(w, tt.view, tt.code)
+		if err != nil {
+			t.Errorf("TestRenderJSONResponseEnvelope %s: %v", name, err)
+			continue
+		}
+		if w.Body.String() != tt.want {
+			t.Errorf("TestRenderJSONResponseEnvelope %s: body %q, expected %q", name, w.Body.String(), tt.want)
+		}
+	}
+}
+
+func TestRenderCharset(t *testing.T) {
+	tests := map[string]struct {
+		enabled bool
+		render  func(w http.ResponseWriter) error
+		want    string
+	}{
+		"default": {true, func(w http.ResponseWriter) error {
+			return RenderJSON(w, testView{Name: "foo"}, http.StatusOK)
+		}, "application/json; charset=utf-8"},
+		"omitted": {false, func(w http.ResponseWriter) error {
+			return RenderJSON(w, testView{Name: "foo"}, http.StatusOK)
+		}, "application/json"},
+		"omitted plain": {false, func(w http.ResponseWriter) error {
+			return RenderPlain(w, "foo", http.StatusOK)
+		}, "text/plain"},
+		"omitted xml": {false, func(w http.ResponseWriter) error {
+			return RenderXML(w, testView{Name: "foo"}, http.StatusOK)
+		}, "application/xml"},
+	}
+	for name, tt := range tests {
+		m := NewMux()
+		m.SetCharset(tt.enabled)
+		m.Get("/", func(w http.ResponseWriter, req *http.Request) error {
+			return tt.render(w)
+		})
+		w := testServe(m, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("TestRenderCharset %s: status %d", name, w.Code)
+			continue
+		}
+		if v := w.Header().Get("Content-Type"); v != tt.want {
+			t.Errorf("TestRenderCharset %s: Content-Type %q, expected %q", name, v, tt.want)
+		}
+	}
+}
+
+func TestRenderTemplateSafe(t *testing.T) {
+	tmpl := template.Must(template.New("page").Parse(`<h1>{{.Name}}</h1>{{call .Fail}}`))
+	tests := map[string]struct {
+		fail func() (string, error)
+		want string
+	}{
+		"success": {func() (string, error) { return "ok", nil }, "<h1>foo</h1>ok"},
+		"failure": {func() (string, error) { return "", errors.New("boom") }, ""},
+	}
+	for name, tt := range tests {
+		w := httptest.NewRecorder()
+		data := map[string]interface{}{"Name": "foo", "Fail": tt.fail}
+		err := RenderTemplateSafe(w, tmpl, data, http.StatusOK)
+		if (err != nil) != (tt.want == "") {
+			t.Errorf("TestRenderTemplateSafe %s: %v", name, err)
+		}
+		if w.Body.String() != tt.want {
+			t.Errorf("TestRenderTemplateSafe %s: body %q, expected %q", name, w.Body.String(), tt.want)
+		}
+		if tt.want == "" && (w.Flushed || len(w.Header()) > 0) {
+			t.Errorf("TestRenderTemplateSafe %s: expected nothing written", name)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	defer func(fn func(interface{}) ([]byte, error)) { Marshal = fn }(Marshal)
+	var got interface{}
+	Marshal = func(v interface{}) ([]byte, error) {
+		got = v
+		return []byte(`{"custom":true}`), nil
+	}
+	view := testView{Name: "foo"}
+	w := httptest.NewRecorder()
+	err := RenderJSON(w, view, http.StatusOK)
+	if err != nil {
+		t.Fatalf("TestMarshal: %v", err)
+	}
+	if got != view {
+		t.Errorf("TestMarshal: marshalled %v, expected %v", got, view)
+	}
+	if w.Body.String() != `{"custom":true}` {
+		t.Errorf("TestMarshal: body %q", w.Body.String())
+	}
+	Marshal = stdMarshal
+	w = httptest.NewRecorder()
+	err = RenderJSON(w, view, http.StatusOK)
+	if err != nil || w.Body.String() == `{"custom":true}` {
+		t.Errorf("TestMarshal: restored body %q error %v", w.Body.String(), err)
+	}
+}
+
+func TestStreamJSON(t *testing.T) {
+	type item struct {
+		ID   int      `json:"id"`
+		Tags []string `json:"tags"`
+	}
+	tests := map[string]struct {
+		view Viewable
+		code int
+	}{
+		"nil":    {nil, http.StatusOK},
+		"string": {"<b>&</b>", http.StatusOK},
+		"map":    {map[string]int{"b": 2, "a": 1}, http.StatusCreated},
+		"struct": {testView{Name: "foo"}, http.StatusOK},
+		"slice":  {[]item{{1, []string{"a"}}, {2, nil}}, http.StatusOK},
+		"error":  {map[string]string{"error": "bad"}, http.StatusBadRequest},
+	}
+	for name, tt := range tests {
+		want := httptest.NewRecorder()
+		err := RenderJSON(want, tt.view, tt.code)
+		if err != nil {
+			t.Fatalf("TestStreamJSON %s: %v", name, err)
+		}
+		w := httptest.NewRecorder()
+		err = StreamJSON(w, tt.view, tt.code)
+		if err != nil {
+			t.Errorf("TestStreamJSON %s: %v", name, err)
+			continue
+		}
+		if w.Code != want.Code {
+			t.Errorf("TestStreamJSON %s: status %d, expected %d", name, w.Code, want.Code)
+		}
+		if w.Header().Get("Content-Type") != want.Header().Get("Content-Type") {
+			t.Errorf("TestStreamJSON %s: content type %q, expected %q", name, w.Header().Get("Content-Type"), want.Header().Get("Content-Type"))
+		}
+		if strings.TrimSuffix(w.Body.String(), "\n") != want.Body.String() {
+			t.Errorf("TestStreamJSON %s: body %q, expected %q", name, w.Body.String(), want.Body.String())
+		}
+		if tt.view != nil && !w.Flushed {
+			t.Errorf("TestStreamJSON %s: headers not flushed", name)
+		}
+	}
+}
+
+func TestStreamJSONError(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := StreamJSON(w, map[string]interface{}{"ch": make(chan int)}, http.StatusOK)
+	if err == nil {
+		t.Fatalf("TestStreamJSONError: expected error")
+	}
+	if w.Code != http.StatusOK || !w.Flushed {
+		t.Errorf("TestStreamJSONError: status %d flushed %t, expected committed %d", w.Code, w.Flushed, http.StatusOK)
+	}
+}
+
+func TestRenderJSONPooled(t *testing.T) {
+	views := []Viewable{
+		map[string]string{"name": strings.Repeat("a", 100)},
+		"<b>",
+		[]int{1, 2},
+		map[string]interface{}{"ch": make(chan int)},
+		testView{Name: "foo"},
+	}
+	for i, view := range views {
+		want, wantErr := json.Marshal(view)
+		w := httptest.NewRecorder()
+		err := RenderJSON(w, view, http.StatusOK)
+		if (err != nil) != (wantErr != nil) {
+			t.Errorf("TestRenderJSONPooled %d: error %v, expected %v", i, err, wantErr)
+			continue
+		}
+		if err != nil {
+			if w.Body.Len() != 0 {
+				t.Errorf("TestRenderJSONPooled %d: body %q written on error", i, w.Body.String())
+			}
+			continue
+		}
+		if w.Body.String() != string(want) {
+			t.Errorf("TestRenderJSONPooled %d: body %q, expected %q", i, w.Body.String(), want)
+		}
+	}
+}
+
+func BenchmarkRenderJSON(b *testing.B) {
+	type item struct {
+		ID    int      `json:"id"`
+		Name  string   `json:"name"`
+		Tags  []string `json:"tags"`
+		Score float64  `json:"score"`
+	}
+	view := make([]item, 100)
+	for i := range view {
+		view[i] = item{ID: i, Name: "item", Tags: []string{"a", "b"}, Score: 1.5}
+	}
+	w := httptest.NewRecorder()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Body.Reset()
+		err := RenderJSON(w, view, http.StatusOK)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRegisterRenderer(t *testing.T) {
+	defer func(s []viewRenderer) { renderers.s = s }(renderers.s)
+	RegisterRenderer("application/x-test", func(view Viewable) bool {
+		_, ok := view.(testView)
+		return ok
+	}, func(w http.ResponseWriter, view Viewable, code int) error {
+		return RenderBytes(w, "application/x-test", []byte(view.(testView).Name), code)
+	})
+	tests := map[string]struct {
+		accept string
+		view   Viewable
+		code   int
+		body   string
+	}{
+		"registered":   {"application/x-test", testView{Name: "foo"}, http.StatusCreated, "foo"},
+		"not accepted": {"application/x-test", "foo", http.StatusNotAcceptable, ""},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", tt.accept)
+		w := httptest.NewRecorder()
+		Render(w, req, tt.view, http.StatusCreated)
+		if w.Code != tt.code {
+			t.Errorf("TestRegisterRenderer %s: status %d, expected %d", name, w.Code, tt.code)
+			continue
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("TestRegisterRenderer %s: body %q, expected %q", name, w.Body.String(), tt.body)
+		}
+	}
+}
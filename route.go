@@ -0,0 +1,212 @@
+package httpc
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"goji.io/middleware"
+	"goji.io/pat"
+	"goji.io/pattern"
+)
+
+// route is a record of a route registered with a mux.
+type route struct {
+	pattern *pat.Pattern
+	any     *pat.Pattern // pattern matching any HTTP method
+	handler Handler
+	mux     *Mux // mounted sub-mux, if any
+	name    string
+	where   map[pattern.Variable]*regexp.Regexp
+	headers []string // CORS request headers
+}
+
+// RouteInfo describes a route registered with a mux.
+type RouteInfo struct {
+	// Pattern is the route pattern, such as /users/:id.
+	Pattern string
+
+	// Methods are the sorted HTTP methods matched by the route,
+	// or nil if the route matches any HTTP method.
+	Methods []string
+
+	// SubMux reports whether the route mounts a sub-mux at the
+	// prefix of Pattern.
+	SubMux bool
+}
+
+// Routes returns the routes registered with m in registration order.
+// The routes of mounted sub-muxes are not included.
+func (m *Mux) Routes() []RouteInfo {
+	routes := make([]RouteInfo, len(m.routes))
+	for i, r := range m.routes {
+		routes[i] = RouteInfo{Pattern: r.pattern.String(), SubMux: r.mux != nil}
+		methods := r.pattern.HTTPMethods()
+		if methods == nil {
+			continue
+		}
+		for method := range methods {
+			routes[i].Methods = append(routes[i].Methods, method)
+		}
+		sort.Strings(routes[i].Methods)
+	}
+	return routes
+}
+
+// RouteOption configures a route registered with a mux.
+type RouteOption func(r *route)
+
+// Where returns a RouteOption that constrains the named parameter of
+// the route to values matching the regular expression expr in full.
+// Requests with a value that does not match fall through to the next
+// matching route, or are not found. For example, a route registered
+// with Where("id", "[0-9]+") matches /users/42 but not /users/new.
+// Where panics if expr is not a valid regular expression.
+func Where(name, expr string) RouteOption {
+	re := regexp.MustCompile(`^(?:` + expr + `)$`)
+	return func(r *route) {
+		if r.where == nil {
+			r.where = make(map[pattern.Variable]*regexp.Regexp)
+		}
+		r.where[pattern.Variable(name)] = re
+	}
+}
+
+// Name returns a RouteOption that names the route for observability,
+// such as for metric labels and trace spans, and for generating paths
+// with Mux.URL. See MatchedName.
+func Name(name string) RouteOption {
+	return func(r *route) {
+		r.name = name
+	}
+}
+
+// URL returns the path of the named route of m or its sub-muxes with
+// the pattern parameters substituted by the escaped values of params.
+// An error is returned if the route is unknown, a parameter is missing
+// or a value does not satisfy the Where constraint of its parameter.
+// The wildcard of a prefix pattern, such as /files/*, is removed.
+func (m *Mux) URL(name string, params map[string]string) (string, error) {
+	r, prefix := m.namedRoute(name)
+	if r == nil {
+		return "", fmt.Errorf("httpc: unknown route %q", name)
+	}
+	var b strings.Builder
+	for _, p := range append(prefix, r) {
+		err := reverseRoute(&b, p, params)
+		if err != nil {
+			return "", fmt.Errorf("httpc: route %q: %w", name, err)
+		}
+	}
+	return b.String(), nil
+}
+
+// namedRoute returns the named route of m or its sub-muxes and
+// the routes of the sub-muxes mounting it, outermost first.
+func (m *Mux) namedRoute(name string) (*route, []*route) {
+	for _, r := range m.routes {
+		if r.mux == nil {
+			if r.name == name {
+				return r, nil
+			}
+			continue
+		}
+		sub, prefix := r.mux.namedRoute(name)
+		if sub != nil {
+			return sub, append([]*route{r}, prefix...)
+		}
+	}
+	return nil, nil
+}
+
+// reverseRoute writes the pattern of r to b with the
+// parameters substituted by the escaped values of params.
+func reverseRoute(b *strings.Builder, r *route, params map[string]string) error {
+	s := strings.TrimSuffix(r.pattern.String(), "*")
+	if r.mux != nil {
+		s = strings.TrimSuffix(s, "/")
+	}
+	for s != "" {
+		i := strings.IndexByte(s, ':')
+		if i < 0 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:i])
+		s = s[i+1:]
+		n := 0
+		for n < len(s) && isParamChar(s[n]) {
+			n++
+		}
+		name := s[:n]
+		s = s[n:]
+		v, ok := params[name]
+		if !ok {
+			return fmt.Errorf("missing parameter %q", name)
+		}
+		re, ok := r.where[pattern.Variable(name)]
+		if ok && !re.MatchString(v) {
+			return fmt.Errorf("invalid parameter %q value %q", name, v)
+		}
+		b.WriteString(url.PathEscape(v))
+	}
+	return nil
+}
+
+// isParamChar reports whether c is valid in a pattern parameter name.
+func isParamChar(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// MatchedName returns the name of the most recently matched route. If
+// the route is unnamed, the name of the handler function is returned.
+// MatchedName returns the empty string if no route registered with the
+// route methods of a mux was matched.
+func MatchedName(req *http.Request) string {
+	p, ok := middleware.Pattern(req.Context()).(*routePattern)
+	if !ok {
+		return ""
+	}
+	if p.route.name != "" {
+		return p.route.name
+	}
+	fn := runtime.FuncForPC(reflect.ValueOf(p.route.handler).Pointer())
+	if fn == nil {
+		return ""
+	}
+	return fn.Name()
+}
+
+// routePattern is the pattern of a route registered
+// with a mux that links the route record.
+type routePattern struct {
+	*pat.Pattern
+	route *route
+}
+
+// Match implements the goji.Pattern interface.
+func (p *routePattern) Match(req *http.Request) *http.Request {
+	req = p.Pattern.Match(req)
+	if req == nil || !matchWhere(req, p.route.where) {
+		return nil
+	}
+	return req
+}
+
+// matchWhere reports whether the bound parameters of the
+// matched request satisfy the parameter constraints.
+func matchWhere(req *http.Request, where map[pattern.Variable]*regexp.Regexp) bool {
+	ctx := req.Context()
+	for name, re := range where {
+		v, ok := ctx.Value(name).(string)
+		if !ok || !re.MatchString(v) {
+			return false
+		}
+	}
+	return true
+}
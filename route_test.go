@@ -0,0 +1,109 @@
+package httpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestMuxRoutes(t *testing.T) {
+	m := NewMux()
+	m.Get("/users", testPatternHandler)
+	m.Post("/users", testPatternHandler)
+	m.Delete("/users/:id", testPatternHandler, Where("id", "[0-9]+"))
+	m.Any("/ping", testPatternHandler)
+	m.Handle("/metrics", http.NotFoundHandler())
+	sub := m.NewSubMux("/admin/*")
+	sub.Get("/settings", testPatternHandler)
+	want := []RouteInfo{
+		{Pattern: "/users", Methods: []string{"GET", "HEAD"}},
+		{Pattern: "/users", Methods: []string{"POST"}},
+		{Pattern: "/users/:id", Methods: []string{"DELETE"}},
+		{Pattern: "/ping"},
+		{Pattern: "/metrics"},
+		{Pattern: "/admin/*", SubMux: true},
+	}
+	have := m.Routes()
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("TestMuxRoutes: %+v, expected %+v", have, want)
+	}
+	have = sub.Routes()
+	want = []RouteInfo{{Pattern: "/settings", Methods: []string{"GET", "HEAD"}}}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("TestMuxRoutes sub-mux: %+v, expected %+v", have, want)
+	}
+}
+
+func TestMatchedName(t *testing.T) {
+	m := NewMux()
+	m.Get("/users", testMatchedNameHandler, Name("users.list"))
+	m.Get("/unnamed", testMatchedNameHandler)
+	tests := map[string]struct {
+		path string
+		want string
+	}{
+		"named":   {"/users", "users.list"},
+		"unnamed": {"/unnamed", "github.com/pnelson/httpc.testMatchedNameHandler"},
+	}
+	for name, tt := range tests {
+		testMatchedName = ""
+		testServe(m, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if have := testMatchedName; have != tt.want {
+			t.Errorf("TestMatchedName %s: %q, expected %q", name, have, tt.want)
+		}
+	}
+	if v := MatchedName(httptest.NewRequest(http.MethodGet, "/", nil)); v != "" {
+		t.Errorf("TestMatchedName unmatched: %q", v)
+	}
+}
+
+var testMatchedName string
+
+func testMatchedNameHandler(w http.ResponseWriter, req *http.Request) error {
+	testMatchedName = MatchedName(req)
+	return nil
+}
+
+func TestMuxURL(t *testing.T) {
+	m := NewMux()
+	m.Get("/users/:id/posts/:slug", testMatchedNameHandler, Name("posts.show"))
+	m.Get("/users/:id", testMatchedNameHandler, Name("users.show"), Where("id", "[0-9]+"))
+	m.Get("/files/*", testMatchedNameHandler, Name("files"))
+	m.Get("/report.:format", testMatchedNameHandler, Name("report"))
+	sub := m.NewSubMux("/orgs/:org/*")
+	sub.Get("/settings/:section", testMatchedNameHandler, Name("org.settings"))
+	tests := map[string]struct {
+		route   string
+		params  map[string]string
+		want    string
+		isValid bool
+	}{
+		"params":        {"posts.show", map[string]string{"id": "42", "slug": "hello-world"}, "/users/42/posts/hello-world", true},
+		"escaped":       {"posts.show", map[string]string{"id": "42", "slug": "a b/c"}, "/users/42/posts/a%20b%2Fc", true},
+		"extra":         {"users.show", map[string]string{"id": "42", "slug": "x"}, "/users/42", true},
+		"where":         {"users.show", map[string]string{"id": "new"}, "", false},
+		"missing":       {"posts.show", map[string]string{"id": "42"}, "", false},
+		"unknown":       {"posts.edit", nil, "", false},
+		"wildcard":      {"files", nil, "/files/", true},
+		"dot":           {"report", map[string]string{"format": "csv"}, "/report.csv", true},
+		"sub-mux":       {"org.settings", map[string]string{"org": "acme", "section": "billing"}, "/orgs/acme/settings/billing", true},
+		"sub-mux param": {"org.settings", map[string]string{"section": "billing"}, "", false},
+	}
+	for name, tt := range tests {
+		have, err := m.URL(tt.route, tt.params)
+		if (err == nil) != tt.isValid {
+			t.Errorf("TestMuxURL %s: error %v", name, err)
+			continue
+		}
+		if have != tt.want {
+			t.Errorf("TestMuxURL %s: %q, expected %q", name, have, tt.want)
+		}
+	}
+	u, _ := m.URL("org.settings", map[string]string{"org": "acme", "section": "billing"})
+	testMatchedName = ""
+	testServe(m, httptest.NewRequest(http.MethodGet, u, nil))
+	if testMatchedName != "org.settings" {
+		t.Errorf("TestMuxURL: generated path matched %q", testMatchedName)
+	}
+}
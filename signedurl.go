@@ -0,0 +1,62 @@
+package httpc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// SignURL returns path with expires and signature query parameters
+// appended for VerifySignedURL, such as for time limited download links.
+// The signature is the HMAC-SHA256 of the path and query using key.
+// Existing query parameters of path are preserved and signed.
+func SignURL(path string, expires time.Time, key []byte) string {
+	u, err := url.Parse(path)
+	if err != nil {
+		u = &url.URL{Path: path}
+	}
+	q := u.Query()
+	q.Del("signature")
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	mac := signURL(u.EscapedPath(), q, key)
+	q.Set("signature", base64.RawURLEncoding.EncodeToString(mac))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// VerifySignedURL verifies that the request URL was signed by SignURL
+// with key and has not expired. ErrInvalidSignature is returned if the
+// signature is missing or does not match and ErrExpiredURL if the URL
+// has expired.
+func VerifySignedURL(req *http.Request, key []byte) error {
+	q := req.URL.Query()
+	mac, err := base64.RawURLEncoding.DecodeString(q.Get("signature"))
+	if err != nil || len(mac) == 0 {
+		return ErrInvalidSignature
+	}
+	q.Del("signature")
+	if !hmac.Equal(mac, signURL(req.URL.EscapedPath(), q, key)) {
+		return ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if time.Now().Unix() >= expires {
+		return ErrExpiredURL
+	}
+	return nil
+}
+
+// signURL returns the HMAC-SHA256 of the path and query.
+func signURL(path string, q url.Values, key []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(path))
+	h.Write([]byte{'?'})
+	h.Write([]byte(q.Encode()))
+	return h.Sum(nil)
+}
@@ -0,0 +1,49 @@
+package httpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedURL(t *testing.T) {
+	key := []byte("secret")
+	future := time.Now().Add(time.Hour)
+	tests := map[string]struct {
+		path    string
+		expires time.Time
+		key     []byte
+		tamper  func(string) string
+		err     error
+		code    int
+	}{
+		"valid":          {"/files/report.pdf", future, key, nil, nil, 0},
+		"query":          {"/files/report.pdf?download=1&b=2", future, key, nil, nil, 0},
+		"escaped":        {"/files/a%2Fb.pdf", future, key, nil, nil, 0},
+		"expired":        {"/files/report.pdf", time.Now().Add(-time.Hour), key, nil, ErrExpiredURL, http.StatusGone},
+		"wrong key":      {"/files/report.pdf", future, []byte("other"), nil, ErrInvalidSignature, http.StatusForbidden},
+		"tampered path":  {"/files/report.pdf", future, key, func(s string) string { return strings.Replace(s, "report", "secret", 1) }, ErrInvalidSignature, http.StatusForbidden},
+		"tampered query": {"/files/report.pdf?download=1", future, key, func(s string) string { return strings.Replace(s, "download=1", "download=2", 1) }, ErrInvalidSignature, http.StatusForbidden},
+		"added query":    {"/files/report.pdf", future, key, func(s string) string { return s + "&admin=1" }, ErrInvalidSignature, http.StatusForbidden},
+		"extended":       {"/files/report.pdf", time.Now().Add(-time.Hour), key, func(s string) string { return strings.Replace(s, "expires=", "expires=9", 1) }, ErrInvalidSignature, http.StatusForbidden},
+		"unsigned":       {"/files/report.pdf", future, key, func(s string) string { return s[:strings.Index(s, "&signature=")] }, ErrInvalidSignature, http.StatusForbidden},
+		"bad signature":  {"/files/report.pdf", future, key, func(s string) string { return s + "!" }, ErrInvalidSignature, http.StatusForbidden},
+	}
+	for name, tt := range tests {
+		u := SignURL(tt.path, tt.expires, tt.key)
+		if tt.tamper != nil {
+			u = tt.tamper(u)
+		}
+		req := httptest.NewRequest(http.MethodGet, u, nil)
+		err := VerifySignedURL(req, key)
+		if err != tt.err {
+			t.Errorf("TestSignedURL %s: error %v, expected %v", name, err, tt.err)
+			continue
+		}
+		if err != nil && statusCode(err) != tt.code {
+			t.Errorf("TestSignedURL %s: status %d, expected %d", name, statusCode(err), tt.code)
+		}
+	}
+}
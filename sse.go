@@ -0,0 +1,69 @@
+package httpc
+
+import (
+	"net/http"
+	"strings"
+)
+
+// An Event is a server-sent event written by RenderEventStream.
+type Event struct {
+	// ID sets the last event ID of the client, if not empty.
+	ID string
+
+	// Name is the event type, if not the default message type.
+	Name string
+
+	// Data is the event data. Each line is written as a data field.
+	Data string
+}
+
+// eventField removes line breaks from the single line event fields.
+var eventField = strings.NewReplacer("\r", "", "\n", "")
+
+// RenderEventStream writes the events received from the channel as a
+// text/event-stream of server-sent events, flushing the response after
+// each event. RenderEventStream returns when the channel is closed or
+// the request context is done. An error is returned if the response
+// writer does not support flushing.
+func RenderEventStream(w http.ResponseWriter, req *http.Request, events <-chan Event) error {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	err := rc.Flush()
+	if err != nil {
+		return err
+	}
+	ctx := req.Context()
+	var b strings.Builder
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			b.Reset()
+			if e.ID != "" {
+				b.WriteString("id: " + eventField.Replace(e.ID) + "\n")
+			}
+			if e.Name != "" {
+				b.WriteString("event: " + eventField.Replace(e.Name) + "\n")
+			}
+			data := strings.ReplaceAll(e.Data, "\r\n", "\n")
+			for _, line := range strings.Split(data, "\n") {
+				b.WriteString("data: " + line + "\n")
+			}
+			b.WriteString("\n")
+			_, err = w.Write([]byte(b.String()))
+			if err != nil {
+				return writeError(err)
+			}
+			err = rc.Flush()
+			if err != nil {
+				return writeError(err)
+			}
+		}
+	}
+}
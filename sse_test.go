@@ -0,0 +1,78 @@
+package httpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testFlusher struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (w *testFlusher) Flush() {
+	w.flushes++
+	w.ResponseRecorder.Flush()
+}
+
+func TestRenderEventStream(t *testing.T) {
+	events := make(chan Event, 4)
+	events <- Event{Data: "hello"}
+	events <- Event{ID: "1", Name: "update", Data: "line one\nline two\r\nline three"}
+	events <- Event{ID: "2\n", Name: "bad\r\nname", Data: ""}
+	close(events)
+	w := &testFlusher{ResponseRecorder: httptest.NewRecorder()}
+	err := RenderEventStream(w, httptest.NewRequest(http.MethodGet, "/", nil), events)
+	if err != nil {
+		t.Fatalf("TestRenderEventStream: %v", err)
+	}
+	if v := w.Header().Get("Content-Type"); v != "text/event-stream" {
+		t.Errorf("TestRenderEventStream: content type %q", v)
+	}
+	if v := w.Header().Get("Cache-Control"); v != "no-cache" {
+		t.Errorf("TestRenderEventStream: cache control %q", v)
+	}
+	want := "data: hello\n\n" +
+		"id: 1\nevent: update\ndata: line one\ndata: line two\ndata: line three\n\n" +
+		"id: 2\nevent: badname\ndata: \n\n"
+	if w.Body.String() != want {
+		t.Errorf("TestRenderEventStream: body\n%q\nexpected\n%q", w.Body.String(), want)
+	}
+	if w.flushes != 4 {
+		t.Errorf("TestRenderEventStream: flushed %d times, expected 4", w.flushes)
+	}
+}
+
+func TestRenderEventStreamCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	events := make(chan Event)
+	done := make(chan error, 1)
+	w := &testFlusher{ResponseRecorder: httptest.NewRecorder()}
+	go func() {
+		done <- RenderEventStream(w, req, events)
+	}()
+	events <- Event{Data: "a"}
+	cancel()
+	err := <-done
+	if err != nil {
+		t.Errorf("TestRenderEventStreamCancel: %v", err)
+	}
+	if w.Body.String() != "data: a\n\n" {
+		t.Errorf("TestRenderEventStreamCancel: body %q", w.Body.String())
+	}
+}
+
+type testNoFlusher struct {
+	http.ResponseWriter
+}
+
+func TestRenderEventStreamNoFlusher(t *testing.T) {
+	w := testNoFlusher{httptest.NewRecorder()}
+	err := RenderEventStream(w, httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	if err == nil {
+		t.Errorf("TestRenderEventStreamNoFlusher: expected error")
+	}
+}
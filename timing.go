@@ -0,0 +1,122 @@
+package httpc
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timing collects server timing metrics for the Server-Timing header.
+// A Timing is safe for concurrent use by multiple goroutines.
+type Timing struct {
+	mu      sync.Mutex
+	start   time.Time
+	metrics []timingMetric
+}
+
+// timingMetric represents a single Server-Timing metric.
+type timingMetric struct {
+	name string
+	dur  time.Duration
+}
+
+// NewTiming returns a new Timing. The duration since NewTiming
+// was called is reported as the total metric when written.
+func NewTiming() *Timing {
+	return &Timing{start: time.Now()}
+}
+
+// Measure records the duration d for the named metric.
+// The name must be a valid HTTP token.
+func (t *Timing) Measure(name string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.metrics = append(t.metrics, timingMetric{name: name, dur: d})
+}
+
+// Write sends the recorded metrics once the handler has finished, so
+// that it may be deferred to include the total duration of the handler.
+// Since the status is usually written before deferred calls run, w should
+// be returned by Wrap, which sets the Server-Timing header with the metrics
+// recorded so far when the status is written:
+//
+//	timing := httpc.NewTiming()
+//	w = timing.Wrap(w)
+//	defer timing.Write(w)
+//
+// If the status has not been written, Write sets the Server-Timing header.
+// Otherwise, if w was not returned by Wrap, the metrics are sent as a
+// Server-Timing trailer, which is only sent with chunked HTTP/1.1 and
+// HTTP/2 responses, such as flushed responses.
+func (t *Timing) Write(w http.ResponseWriter) {
+	if tw, ok := w.(*timingWriter); ok && tw.timing == t {
+		if !tw.wroteHeader {
+			tw.wroteHeader = true
+			w.Header().Set("Server-Timing", t.String())
+		}
+		return
+	}
+	w.Header().Set(http.TrailerPrefix+"Server-Timing", t.String())
+}
+
+// Wrap returns a http.ResponseWriter that sets the Server-Timing
+// header with the metrics recorded so far when the status is written.
+func (t *Timing) Wrap(w http.ResponseWriter) http.ResponseWriter {
+	return &timingWriter{ResponseWriter: w, timing: t}
+}
+
+// String returns the Server-Timing header value of the recorded metrics.
+func (t *Timing) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	metrics := make([]timingMetric, len(t.metrics), len(t.metrics)+1)
+	copy(metrics, t.metrics)
+	metrics = append(metrics, timingMetric{name: "total", dur: time.Since(t.start)})
+	s := make([]string, len(metrics))
+	for i, m := range metrics {
+		s[i] = m.name + ";dur=" + strconv.FormatFloat(float64(m.dur)/float64(time.Millisecond), 'f', -1, 64)
+	}
+	return strings.Join(s, ", ")
+}
+
+// timingWriter is a http.ResponseWriter that sets
+// the Server-Timing header when the status is written.
+type timingWriter struct {
+	http.ResponseWriter
+	timing      *Timing
+	wroteHeader bool
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+func (w *timingWriter) WriteHeader(code int) {
+	if !w.wroteHeader && code >= http.StatusOK {
+		w.wroteHeader = true
+		w.Header().Set("Server-Timing", w.timing.String())
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements the http.ResponseWriter interface.
+func (w *timingWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements the http.Flusher interface.
+func (w *timingWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter.
+func (w *timingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,84 @@
+package httpc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestTiming(t *testing.T) {
+	re := regexp.MustCompile(`^db;dur=12\.5, cache;dur=0\.3, total;dur=[0-9.]+$`)
+	tests := map[string]struct {
+		h       http.HandlerFunc
+		trailer bool
+	}{
+		"wrap": {
+			h: func(w http.ResponseWriter, req *http.Request) {
+				timing := NewTiming()
+				w = timing.Wrap(w)
+				defer timing.Write(w)
+				timing.Measure("db", 12500*time.Microsecond)
+				timing.Measure("cache", 300*time.Microsecond)
+				RenderPlain(w, "ok", http.StatusOK)
+				timing.Measure("late", time.Millisecond)
+			},
+		},
+		"wrap no body": {
+			h: func(w http.ResponseWriter, req *http.Request) {
+				timing := NewTiming()
+				w = timing.Wrap(w)
+				defer timing.Write(w)
+				timing.Measure("db", 12500*time.Microsecond)
+				timing.Measure("cache", 300*time.Microsecond)
+			},
+		},
+		"trailer": {
+			h: func(w http.ResponseWriter, req *http.Request) {
+				timing := NewTiming()
+				defer timing.Write(w)
+				RenderPlain(w, "ok", http.StatusOK)
+				w.(http.Flusher).Flush()
+				timing.Measure("db", 12500*time.Microsecond)
+				timing.Measure("cache", 300*time.Microsecond)
+			},
+			trailer: true,
+		},
+	}
+	for name, tt := range tests {
+		srv := httptest.NewServer(tt.h)
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			srv.Close()
+			t.Fatalf("TestTiming %s: %v", name, err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+		srv.Close()
+		v := resp.Header.Get("Server-Timing")
+		if tt.trailer {
+			v = resp.Trailer.Get("Server-Timing")
+		}
+		if !re.MatchString(v) {
+			t.Errorf("TestTiming %s: Server-Timing %q", name, v)
+		}
+	}
+}
+
+func TestTimingString(t *testing.T) {
+	timing := NewTiming()
+	for i := 0; i < 3; i++ {
+		timing.Measure("m", time.Millisecond)
+	}
+	a := timing.String()
+	timing.Measure("n", time.Millisecond)
+	if n := len(timing.metrics); n != 4 {
+		t.Errorf("TestTimingString: %d metrics, expected 4", n)
+	}
+	re := regexp.MustCompile(`^m;dur=1, m;dur=1, m;dur=1, total;dur=[0-9.]+$`)
+	if !re.MatchString(a) {
+		t.Errorf("TestTimingString: %q", a)
+	}
+}
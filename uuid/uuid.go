@@ -0,0 +1,21 @@
+// Package uuid parses httpc route parameters as UUIDs.
+package uuid
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/pnelson/httpc"
+)
+
+// Param returns the bound parameter with the given name parsed as a UUID.
+// An error wrapping httpc.ErrInvalidParam is returned if it is malformed.
+func Param(req *http.Request, name string) (uuid.UUID, error) {
+	v := httpc.Param(req, name)
+	id, err := uuid.Parse(v)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w %s %q", httpc.ErrInvalidParam, name, v)
+	}
+	return id, nil
+}
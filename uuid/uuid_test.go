@@ -0,0 +1,45 @@
+package uuid
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/pnelson/httpc"
+)
+
+func TestParam(t *testing.T) {
+	tests := map[string]struct {
+		path string
+		want uuid.UUID
+		err  error
+	}{
+		"valid":     {"/users/6ba7b810-9dad-11d1-80b4-00c04fd430c8", uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8"), nil},
+		"uppercase": {"/users/6BA7B810-9DAD-11D1-80B4-00C04FD430C8", uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8"), nil},
+		"malformed": {"/users/6ba7b810-9dad-11d1-80b4", uuid.Nil, httpc.ErrInvalidParam},
+		"invalid":   {"/users/not-a-uuid", uuid.Nil, httpc.ErrInvalidParam},
+	}
+	for name, tt := range tests {
+		var id uuid.UUID
+		var err error
+		m := httpc.NewMux()
+		m.Get("/users/:id", func(w http.ResponseWriter, req *http.Request) error {
+			id, err = Param(req, "id")
+			return err
+		})
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if !errors.Is(err, tt.err) || (err == nil) != (tt.err == nil) {
+			t.Errorf("TestParam %s: error %v, expected %v", name, err, tt.err)
+			continue
+		}
+		if id != tt.want {
+			t.Errorf("TestParam %s: %s, expected %s", name, id, tt.want)
+		}
+		if err != nil && w.Code != http.StatusBadRequest {
+			t.Errorf("TestParam %s: status %d, expected %d", name, w.Code, http.StatusBadRequest)
+		}
+	}
+}
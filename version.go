@@ -0,0 +1,61 @@
+package httpc
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// APIVersionPath enables APIVersion to fall back to a version path
+// prefix such as /v2/ when the Accept header has no vendor version.
+var APIVersionPath = true
+
+// APIVersion returns the API version requested by the client. The version
+// is parsed from a vendor media type in the Accept header, such as
+// application/vnd.example.v2+json, or if APIVersionPath is enabled from
+// the leading path segment, such as /v2/users. If the version is absent
+// or invalid, APIVersion returns defaultV.
+func APIVersion(req *http.Request, defaultV int) int {
+	for _, h := range strings.Split(req.Header.Get("Accept"), ",") {
+		media, _, err := mime.ParseMediaType(h)
+		if err != nil {
+			continue
+		}
+		v, ok := vendorVersion(media)
+		if ok {
+			return v
+		}
+	}
+	if APIVersionPath {
+		segment, _, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+		v, ok := parseVersion(segment)
+		if ok {
+			return v
+		}
+	}
+	return defaultV
+}
+
+// vendorVersion returns the version of a vendor media type.
+func vendorVersion(media string) (int, bool) {
+	typ, subtype, ok := strings.Cut(media, "/")
+	if !ok || typ != "application" || !strings.HasPrefix(subtype, "vnd.") {
+		return 0, false
+	}
+	subtype, _, _ = strings.Cut(subtype, "+")
+	i := strings.LastIndex(subtype, ".")
+	return parseVersion(subtype[i+1:])
+}
+
+// parseVersion parses a version of the form v2.
+func parseVersion(s string) (int, bool) {
+	if len(s) < 2 || s[0] != 'v' {
+		return 0, false
+	}
+	v, err := strconv.Atoi(s[1:])
+	if err != nil || v < 1 || s[1] == '+' {
+		return 0, false
+	}
+	return v, true
+}
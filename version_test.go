@@ -0,0 +1,49 @@
+package httpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIVersion(t *testing.T) {
+	tests := map[string]struct {
+		path   string
+		accept string
+		want   int
+	}{
+		"default":            {"/users", "", 1},
+		"vendor":             {"/users", "application/vnd.example.v2+json", 2},
+		"vendor no suffix":   {"/users", "application/vnd.example.v3", 3},
+		"vendor in list":     {"/users", "text/html, application/vnd.example.v4+json;q=0.9", 4},
+		"vendor without":     {"/users", "application/vnd.example+json", 1},
+		"vendor over path":   {"/v2/users", "application/vnd.example.v3+json", 3},
+		"path":               {"/v2/users", "application/json", 2},
+		"path root":          {"/v5", "", 5},
+		"path invalid":       {"/v0/users", "", 1},
+		"path not version":   {"/videos", "", 1},
+		"path not first":     {"/api/v2/users", "", 1},
+		"vendor invalid":     {"/users", "application/vnd.example.vx+json", 1},
+		"non-vendor version": {"/users", "application/example.v2+json", 1},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		have := APIVersion(req, 1)
+		if have != tt.want {
+			t.Errorf("TestAPIVersion %s: %d, expected %d", name, have, tt.want)
+		}
+	}
+}
+
+func TestAPIVersionPathDisabled(t *testing.T) {
+	defer func(v bool) { APIVersionPath = v }(APIVersionPath)
+	APIVersionPath = false
+	req := httptest.NewRequest(http.MethodGet, "/v2/users", nil)
+	have := APIVersion(req, 1)
+	if have != 1 {
+		t.Errorf("TestAPIVersionPathDisabled: %d, expected 1", have)
+	}
+}
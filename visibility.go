@@ -0,0 +1,175 @@
+package httpc
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// WithRole returns a shallow copy of req with the role of the current
+// user stored in its context. The role is used by RenderVisible to
+// include fields restricted with the visibility struct tag.
+func WithRole(req *http.Request, role string) *http.Request {
+	ctx := context.WithValue(req.Context(), keyRole, role)
+	return req.WithContext(ctx)
+}
+
+// Role returns the role stored in the request context by
+// WithRole, or the empty string if there is none.
+func Role(req *http.Request) string {
+	role, _ := req.Context().Value(keyRole).(string)
+	return role
+}
+
+// RenderVisible writes the view as marshalled JSON, omitting struct
+// fields restricted to roles other than the role of the request. Fields
+// are restricted with a visibility struct tag listing the permitted
+// roles, such as `visibility:"admin,staff"`. Restricted fields are
+// omitted when no role is stored in the request context.
+//
+// Structs are converted to maps before marshalling, so their fields are
+// rendered in sorted order. Types that implement json.Marshaler or
+// encoding.TextMarshaler are rendered as is.
+func RenderVisible(w http.ResponseWriter, req *http.Request, view Viewable, code int) error {
+	if view != nil {
+		view = visible(reflect.ValueOf(view), Role(req))
+	}
+	return RenderJSON(w, view, code)
+}
+
+// visible returns the JSON equivalent of v with
+// fields not visible to the role removed.
+func visible(v reflect.Value, role string) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	t := v.Type()
+	if t.Implements(marshalerType) || t.Implements(textMarshalerType) {
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return visible(v.Elem(), role)
+	case reflect.Struct:
+		m := make(map[string]interface{})
+		visibleFields(m, v, role)
+		return m
+	case reflect.Slice:
+		if v.IsNil() || t.Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		fallthrough
+	case reflect.Array:
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			s[i] = visible(v.Index(i), role)
+		}
+		return s
+	case reflect.Map:
+		if v.IsNil() {
+			return v.Interface()
+		}
+		it := reflect.TypeOf((*interface{})(nil)).Elem()
+		m := reflect.MakeMapWithSize(reflect.MapOf(t.Key(), it), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			e := reflect.New(it).Elem()
+			x := visible(iter.Value(), role)
+			if x != nil {
+				e.Set(reflect.ValueOf(x))
+			}
+			m.SetMapIndex(iter.Key(), e)
+		}
+		return m.Interface()
+	}
+	return v.Interface()
+}
+
+// visibleFields adds the fields of the struct v visible to the role
+// to m, keyed by their JSON names. Fields of embedded structs are
+// promoted unless shadowed by a field of the outer struct.
+func visibleFields(m map[string]interface{}, v reflect.Value, role string) {
+	t := v.Type()
+	var embedded []reflect.Value
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		vis, restricted := f.Tag.Lookup("visibility")
+		if restricted && !hasRole(vis, role) {
+			continue
+		}
+		fv := v.Field(i)
+		if f.Anonymous && name == "" {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				embedded = append(embedded, fv)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.Contains(","+opts+",", ",omitempty,") && isEmptyValue(fv) {
+			continue
+		}
+		m[name] = visible(fv, role)
+	}
+	for _, ev := range embedded {
+		em := make(map[string]interface{})
+		visibleFields(em, ev, role)
+		for k, x := range em {
+			if _, ok := m[k]; !ok {
+				m[k] = x
+			}
+		}
+	}
+}
+
+// hasRole reports whether role is in the comma separated roles.
+func hasRole(roles, role string) bool {
+	if role == "" {
+		return false
+	}
+	for _, r := range strings.Split(roles, ",") {
+		if strings.TrimSpace(r) == role {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmptyValue reports whether v is empty as defined by
+// the omitempty option of encoding/json.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
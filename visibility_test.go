@@ -0,0 +1,60 @@
+package httpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testAudit struct {
+	CreatedBy string `json:"created_by" visibility:"admin"`
+}
+
+type testAccount struct {
+	testAudit
+	ID      int               `json:"id"`
+	Email   string            `json:"email" visibility:"admin,staff"`
+	Notes   string            `json:"notes,omitempty" visibility:"admin"`
+	Created time.Time         `json:"created"`
+	Friends []testAccount     `json:"friends,omitempty"`
+	Meta    map[string]string `json:"-"`
+	secret  string
+}
+
+func TestRenderVisible(t *testing.T) {
+	created := time.Date(2016, 12, 26, 0, 0, 0, 0, time.UTC)
+	view := testAccount{
+		testAudit: testAudit{CreatedBy: "root"},
+		ID:        1,
+		Email:     "foo@example.com",
+		Created:   created,
+		Friends:   []testAccount{{ID: 2, Email: "bar@example.com", Created: created}},
+		Meta:      map[string]string{"a": "b"},
+		secret:    "secret",
+	}
+	tests := map[string]struct {
+		role string
+		want string
+	}{
+		"none":  {"", `{"created":"2016-12-26T00:00:00Z","friends":[{"created":"2016-12-26T00:00:00Z","id":2}],"id":1}`},
+		"user":  {"user", `{"created":"2016-12-26T00:00:00Z","friends":[{"created":"2016-12-26T00:00:00Z","id":2}],"id":1}`},
+		"staff": {"staff", `{"created":"2016-12-26T00:00:00Z","email":"foo@example.com","friends":[{"created":"2016-12-26T00:00:00Z","email":"bar@example.com","id":2}],"id":1}`},
+		"admin": {"admin", `{"created":"2016-12-26T00:00:00Z","created_by":"root","email":"foo@example.com","friends":[{"created":"2016-12-26T00:00:00Z","created_by":"","email":"bar@example.com","id":2}],"id":1}`},
+	}
+	for name, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.role != "" {
+			req = WithRole(req, tt.role)
+		}
+		w := httptest.NewRecorder()
+		err := RenderVisible(w, req, view, http.StatusOK)
+		if err != nil {
+			t.Errorf("TestRenderVisible %s: %v", name, err)
+			continue
+		}
+		if w.Body.String() != tt.want {
+			t.Errorf("TestRenderVisible %s: body\n%s\nexpected\n%s", name, w.Body.String(), tt.want)
+		}
+	}
+}
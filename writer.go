@@ -0,0 +1,134 @@
+package httpc
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+)
+
+// bufferedWriter is a http.ResponseWriter that buffers the
+// response in memory until it is committed to another writer.
+type bufferedWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+	code   int
+	buf    bytes.Buffer
+}
+
+// newBufferedWriter returns a new bufferedWriter with
+// a copy of the headers already set on w.
+func newBufferedWriter(w http.ResponseWriter) *bufferedWriter {
+	return &bufferedWriter{w: w, header: w.Header().Clone()}
+}
+
+// Header implements the http.ResponseWriter interface.
+func (w *bufferedWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+// Informational status codes are not buffered.
+func (w *bufferedWriter) WriteHeader(code int) {
+	if w.code == 0 && code >= http.StatusOK {
+		w.code = code
+	}
+}
+
+// Write implements the http.ResponseWriter interface.
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.buf.Write(b)
+}
+
+// FlushError returns http.ErrNotSupported so that
+// http.ResponseController does not flush the underlying
+// http.ResponseWriter around the buffered response.
+func (w *bufferedWriter) FlushError() error {
+	return http.ErrNotSupported
+}
+
+// Unwrap returns the underlying http.ResponseWriter, if any,
+// so that http.ResponseController can set its deadlines.
+func (w *bufferedWriter) Unwrap() http.ResponseWriter {
+	return w.w
+}
+
+// status returns the buffered status code.
+func (w *bufferedWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+// commit writes the buffered response to w.
+func (w *bufferedWriter) commit(dst http.ResponseWriter) error {
+	h := dst.Header()
+	for k := range h {
+		delete(h, k)
+	}
+	for k, v := range w.header {
+		h[k] = v
+	}
+	dst.WriteHeader(w.status())
+	_, err := dst.Write(w.buf.Bytes())
+	return writeError(err)
+}
+
+// headWriter is a http.ResponseWriter that discards the response body
+// and counts its size in order to reply to HEAD requests.
+type headWriter struct {
+	bufferedWriter
+	n       int64
+	flushed bool
+}
+
+// newHeadWriter returns a new headWriter with
+// a copy of the headers already set on w.
+func newHeadWriter(w http.ResponseWriter) *headWriter {
+	return &headWriter{bufferedWriter: bufferedWriter{w: w, header: w.Header().Clone()}}
+}
+
+// Write implements the http.ResponseWriter interface.
+func (w *headWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	w.n += int64(len(b))
+	return len(b), nil
+}
+
+// Flush implements the http.Flusher interface.
+func (w *headWriter) Flush() {
+	w.FlushError()
+}
+
+// FlushError writes the response headers to the underlying writer without
+// a Content-Length, since the length of a flushed body is not known, so
+// that HEAD requests to streaming handlers reply as soon as GET requests.
+func (w *headWriter) FlushError() error {
+	if !w.flushed {
+		w.flushed = true
+		err := w.bufferedWriter.commit(w.w)
+		if err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(w.w).Flush()
+}
+
+// commit writes the response headers to w with the Content-Length of
+// the discarded body, unless already set or not permitted by the status,
+// or already written by FlushError.
+func (w *headWriter) commit(dst http.ResponseWriter) error {
+	if w.flushed {
+		return nil
+	}
+	code := w.status()
+	if w.header.Get("Content-Length") == "" && code >= http.StatusOK && code != http.StatusNoContent && code != http.StatusNotModified {
+		w.header.Set("Content-Length", strconv.FormatInt(w.n, 10))
+	}
+	return w.bufferedWriter.commit(dst)
+}
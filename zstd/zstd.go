@@ -0,0 +1,22 @@
+// Package zstd registers the zstd content coding with httpc.
+//
+// Import the package for its side effect to compress responses
+// with Zstandard:
+//
+//	import _ "github.com/pnelson/httpc/zstd"
+package zstd
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pnelson/httpc"
+)
+
+func init() {
+	httpc.RegisterEncoder("zstd", func(w io.Writer) io.WriteCloser {
+		// NewWriter only fails on invalid options.
+		enc, _ := zstd.NewWriter(w)
+		return enc
+	})
+}
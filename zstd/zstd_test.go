@@ -0,0 +1,39 @@
+package zstd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pnelson/httpc"
+)
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat("compress me ", 100)
+	h := httpc.Compress(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, body)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br, zstd")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if v := w.Header().Get("Content-Encoding"); v != "zstd" {
+		t.Fatalf("TestCompress: Content-Encoding %q, expected %q", v, "zstd")
+	}
+	r, err := zstd.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("TestCompress: %v", err)
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("TestCompress: %v", err)
+	}
+	if string(b) != body {
+		t.Errorf("TestCompress: body mismatch")
+	}
+}